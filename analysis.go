@@ -0,0 +1,338 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/entooone/simple-midi-synth/internal/time"
+)
+
+// TimeSig is a timeSignature meta event of a MIDI file
+type TimeSig struct {
+	// Tick is the absolute time in ticks
+	Tick int
+	// Time is the absolute time in seconds
+	Time float64
+	// Numerator is the number of beats in a bar
+	Numerator int
+	// Denominator is the note value of a beat (e.g. 4 for a quarter note)
+	Denominator int
+}
+
+// TimeSignatures extracts the time signatures in order of time
+func TimeSignatures(reader io.Reader) ([]TimeSig, error) {
+	midi, err := parseMIDI(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	timer, err := midi.timer(0)
+	if err != nil {
+		return nil, err
+	}
+
+	// denominators out of range are clamped
+	timeSignatures, _ := midi.timeSignatures(timer)
+	return timeSignatures, nil
+}
+
+// TempoChange is a setTempo meta event of a MIDI file
+type TempoChange struct {
+	// Tick is the absolute time in ticks
+	Tick int
+	// Time is the absolute time in seconds
+	Time float64
+	// MicrosecondsPerBeat is the length of a quarter note
+	MicrosecondsPerBeat int
+	// BPM is the number of quarter notes per minute
+	BPM float64
+}
+
+// TempoMap extracts the tempo changes of the first track in order of time
+// starting with the default of 120 BPM if no tempo is set at tick 0
+// (the times of SMPTE files do not depend on the tempo)
+func TempoMap(reader io.Reader) ([]TempoChange, error) {
+	midi, err := parseMIDI(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := midi.tempoChanges(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 || changes[0].tick > 0 {
+		changes = append([]tempoChange{{
+			tick:                0,
+			microsecondsPerBeat: time.MicrosecondsPerBeatDefault,
+		}}, changes...)
+	}
+
+	timer, err := midi.timer(0)
+	if err != nil {
+		return nil, err
+	}
+
+	tempoMap := make([]TempoChange, 0, len(changes))
+	for _, change := range changes {
+		bpm := 0.0
+		if change.microsecondsPerBeat > 0 {
+			bpm = 60e6 / float64(change.microsecondsPerBeat)
+		}
+		tempoMap = append(tempoMap, TempoChange{
+			Tick:                change.tick,
+			Time:                timer.Time(change.tick),
+			MicrosecondsPerBeat: change.microsecondsPerBeat,
+			BPM:                 bpm,
+		})
+	}
+
+	return tempoMap, nil
+}
+
+// TimeDivision is the unit of the delta times of a MIDI file
+type TimeDivision struct {
+	// SMPTE is true if delta times are subdivisions of SMPTE frames
+	// (whose time setTempo events do not change) instead of subdivisions of a beat
+	SMPTE bool
+	// TicksPerBeat is the number of ticks in a quarter note unless SMPTE
+	TicksPerBeat int
+	// FramesPerSecond is the SMPTE frame rate (24, 25, 29 for 29.97 or 30) if SMPTE
+	FramesPerSecond int
+	// TicksPerFrame is the number of ticks in a SMPTE frame if SMPTE
+	TicksPerFrame int
+}
+
+// Timing reads the time division of a MIDI file
+// (e.g. to know whether it can be converted before converting it)
+func Timing(reader io.Reader) (TimeDivision, error) {
+	midi, err := parseMIDI(reader)
+	if err != nil {
+		return TimeDivision{}, err
+	}
+
+	if !midi.smpte() {
+		return TimeDivision{
+			TicksPerBeat: midi.ticksPerBeat(),
+		}, nil
+	}
+
+	// the upper byte is the negative frame rate in two's complement
+	return TimeDivision{
+		SMPTE:           true,
+		FramesPerSecond: -int(int8(midi.timeDivision >> 8)),
+		TicksPerFrame:   midi.ticksPerFrame(),
+	}, nil
+}
+
+// KeySignature is a keySignature meta event of a MIDI file
+type KeySignature struct {
+	// Tick is the absolute time in ticks
+	Tick int
+	// Time is the absolute time in seconds
+	Time float64
+	// Key is the number of sharps (positive) or flats (negative)
+	Key int
+	// Minor is true for a minor key
+	Minor bool
+	// Name is human-readable name of the key (e.g. "G major")
+	Name string
+}
+
+var (
+	majorKeyNames = []string{
+		"Cb", "Gb", "Db", "Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#",
+	}
+	minorKeyNames = []string{
+		"Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#", "G#", "D#", "A#",
+	}
+)
+
+// keyName converts number of sharps or flats into name of the key
+func keyName(key int, minor bool) string {
+	// circle of fifths ranges from 7 flats to 7 sharps
+	if key < -7 || key > 7 {
+		return "unknown"
+	}
+	if minor {
+		return minorKeyNames[key+7] + " minor"
+	}
+	return majorKeyNames[key+7] + " major"
+}
+
+// KeySignatures extracts the key signatures of all tracks in order of time
+func KeySignatures(reader io.Reader) ([]KeySignature, error) {
+	midi, err := parseMIDI(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	timer, err := midi.timer(0)
+	if err != nil {
+		return nil, err
+	}
+
+	keySignatures := make([]KeySignature, 0)
+	for _, track := range midi.tracks {
+		for _, event := range track {
+			if event.subType != "keySignature" {
+				continue
+			}
+
+			key, _ := strconv.Atoi(event.value["key"])
+			minor := event.value["scale"] == "1"
+			keySignatures = append(keySignatures, KeySignature{
+				Tick:  event.tick,
+				Time:  timer.Time(event.tick),
+				Key:   key,
+				Minor: minor,
+				Name:  keyName(key, minor),
+			})
+		}
+	}
+
+	sort.SliceStable(keySignatures, func(i, j int) bool {
+		return keySignatures[i].Tick < keySignatures[j].Tick
+	})
+
+	return keySignatures, nil
+}
+
+// Note is a note of a MIDI file as rendered
+type Note struct {
+	// Pitch is the MIDI note number
+	Pitch int
+	// Name is the name of the note (e.g. "C4")
+	Name string
+	// Start is the absolute time in seconds where the note starts
+	Start float64
+	// Duration is the length of the note in seconds
+	Duration float64
+	// Velocity is the velocity of the noteOn event
+	Velocity int
+	// Channel is the MIDI channel of the note
+	Channel int
+}
+
+// PianoRoll extracts the notes in order of time (e.g. to draw a piano roll)
+func PianoRoll(reader io.Reader) ([]Note, error) {
+	midi, err := parseMIDI(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	timer, err := midi.timer(0)
+	if err != nil {
+		return nil, err
+	}
+
+	prog, _, _, err := collectNotes(midi, timer, Options{})
+	if err != nil {
+		return nil, err
+	}
+	sortProgression(prog)
+
+	notes := make([]Note, len(prog))
+	for i, p := range prog {
+		pitch, _ := semitoneFromNote(p.note)
+		notes[i] = Note{
+			Pitch:    pitch,
+			Name:     p.note,
+			Start:    p.offset,
+			Duration: p.time,
+			Velocity: int(p.amplitude * 128),
+			Channel:  p.channel,
+		}
+	}
+
+	return notes, nil
+}
+
+// EstimateCost counts the notes and sums their durations in seconds
+// without rendering them (e.g. to predict the time of a conversion
+// which grows with the total duration of the notes)
+func EstimateCost(reader io.Reader) (notes int, totalNoteSeconds float32, err error) {
+	midi, err := parseMIDI(reader)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	timer, err := midi.timer(0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	prog, _, _, err := collectNotes(midi, timer, Options{})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var total float64
+	for _, p := range prog {
+		total += p.time
+	}
+
+	return len(prog), float32(total), nil
+}
+
+// Annotation is a text, lyrics, marker or cuePoint meta event of a MIDI file
+type Annotation struct {
+	// Tick is the absolute time in ticks
+	Tick int
+	// Time is the absolute time in seconds
+	Time float64
+	// Type is the sub type of the event ("text", "lyrics", "marker" or "cuePoint")
+	Type string
+	// Text is the text of the event
+	Text string
+}
+
+// Annotations extracts the textual events of all tracks in order of time
+// (e.g. to show lyrics and section names along with playback)
+func Annotations(reader io.Reader) ([]Annotation, error) {
+	midi, err := parseMIDI(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	timer, err := midi.timer(0)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := make([]Annotation, 0)
+	for _, track := range midi.tracks {
+		for _, event := range track {
+			switch event.subType {
+			case "text", "lyrics", "marker", "cuePoint":
+				annotations = append(annotations, Annotation{
+					Tick: event.tick,
+					Time: timer.Time(event.tick),
+					Type: event.subType,
+					Text: event.value["value"],
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(annotations, func(i, j int) bool {
+		return annotations[i].Tick < annotations[j].Tick
+	})
+
+	return annotations, nil
+}
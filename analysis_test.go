@@ -0,0 +1,97 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+// keySignature encodes a keySignature meta event after delta ticks
+func keySignature(delta uint, key int8, minor bool) []byte {
+	scale := byte(0)
+	if minor {
+		scale = 1
+	}
+	return event(delta, 0xff, 0x59, 0x02, byte(key), scale)
+}
+
+func TestKeySignatures(t *testing.T) {
+	data := smf(0, 480, track(
+		keySignature(0, 0, false),
+		keySignature(1, 1, false),
+		keySignature(479, 1, true),
+		keySignature(480, -3, false),
+		keySignature(0, 7, true),
+	))
+
+	want := []KeySignature{
+		{Tick: 0, Time: 0, Key: 0, Minor: false, Name: "C major"},
+		// sub-millisecond times are kept
+		{Tick: 1, Time: 1.0 / 960, Key: 1, Minor: false, Name: "G major"},
+		{Tick: 480, Time: 0.5, Key: 1, Minor: true, Name: "E minor"},
+		{Tick: 960, Time: 1, Key: -3, Minor: false, Name: "Eb major"},
+		{Tick: 960, Time: 1, Key: 7, Minor: true, Name: "A# minor"},
+	}
+
+	got, err := KeySignatures(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("KeySignatures() error = %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("KeySignatures() returned %d signatures, want %d", len(got), len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Tick != w.Tick || math.Abs(g.Time-w.Time) > 1e-12 || g.Key != w.Key || g.Minor != w.Minor || g.Name != w.Name {
+			t.Errorf("signature %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestTimeSignatures(t *testing.T) {
+	data := smf(1, 480,
+		track(
+			event(0, 0xff, 0x58, 0x04, 0x04, 0x02, 0x18, 0x08),
+			event(1920, 0xff, 0x58, 0x04, 0x06, 0x03, 0x18, 0x08),
+			// the denominator 2^64 is clamped to 64
+			event(1440, 0xff, 0x58, 0x04, 0x03, 0x40, 0x18, 0x08),
+		),
+		track(noteOn(0, 60, 100), noteOff(3840, 60)),
+	)
+
+	want := []TimeSig{
+		{Tick: 0, Time: 0, Numerator: 4, Denominator: 4},
+		{Tick: 1920, Time: 2, Numerator: 6, Denominator: 8},
+		{Tick: 3360, Time: 3.5, Numerator: 3, Denominator: 64},
+	}
+
+	got, err := TimeSignatures(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("TimeSignatures() error = %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("TimeSignatures() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("signature %d = %+v, want %+v", i, got[i], want[i])
+		}
+		if got[i].Denominator <= 0 {
+			t.Errorf("signature %d has denominator %d", i, got[i].Denominator)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "math"
+
+// maxAutoGain limits the boost of quiet regions by autoGain (18 dB)
+const maxAutoGain = 8
+
+// autoGain scales each window of time in seconds so that its peak reaches
+// the normalized amplitude changing the gain smoothly between the windows
+// (a simple automatic gain control)
+func (w *wavData) autoGain(amplitude float32, window float64) {
+	var (
+		numChannels = int(w.numChannels)
+		frames      = w.length / numChannels
+		size        = maxInt(w.frame(window), 1)
+		count       = (frames + size - 1) / size
+	)
+	if count == 0 {
+		return
+	}
+
+	gains := make([]float64, count)
+	for k := range gains {
+		var peak float32
+		for _, d := range w.data[k*size*numChannels : minInt((k+1)*size, frames)*numChannels] {
+			peak = float32(math.Max(float64(peak), math.Abs(float64(d))))
+		}
+		gains[k] = maxAutoGain
+		if peak > 0 {
+			gains[k] = math.Min(float64(amplitude/peak), maxAutoGain)
+		}
+	}
+
+	// the gain changes over the neighbouring windows
+	// so that it is at most the gain of each window within it
+	smoothed := make([]float64, count)
+	for k := range gains {
+		smoothed[k] = gains[k]
+		if k > 0 {
+			smoothed[k] = math.Min(smoothed[k], gains[k-1])
+		}
+		if k+1 < count {
+			smoothed[k] = math.Min(smoothed[k], gains[k+1])
+		}
+	}
+
+	// interpolate between the centers of the windows
+	for i := 0; i < frames; i++ {
+		x := (float64(i)+0.5)/float64(size) - 0.5
+		k := int(math.Floor(x))
+		var gain float64
+		switch {
+		case k < 0:
+			gain = smoothed[0]
+		case k+1 >= count:
+			gain = smoothed[count-1]
+		default:
+			gain = smoothed[k] + (smoothed[k+1]-smoothed[k])*(x-float64(k))
+		}
+		for c := 0; c < numChannels; c++ {
+			w.data[i*numChannels+c] *= float32(gain)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestAutoGain(t *testing.T) {
+	// a solo note for 2 seconds, a rest of 1 second and a chord for 2 seconds
+	chord := []byte{60, 64, 67, 72}
+	events := [][]byte{noteOn(0, 69, 100), noteOff(1920, 69)}
+	for i, n := range chord {
+		delta := uint(0)
+		if i == 0 {
+			delta = 960
+		}
+		events = append(events, noteOn(delta, n, 100))
+	}
+	for i, n := range chord {
+		delta := uint(0)
+		if i == 0 {
+			delta = 1920
+		}
+		events = append(events, noteOff(delta, n))
+	}
+	data := smf(0, 480, track(events...))
+
+	// peak returns the peak of samples between the seconds
+	peak := func(samples []float32, rate uint32, from, to float64) float64 {
+		var p float64
+		for _, s := range samples[int(from*float64(rate)):int(to*float64(rate))] {
+			p = math.Max(p, math.Abs(float64(s)))
+		}
+		return p
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		// bounds of the ratio of the solo peak to the chord peak
+		minRatio, maxRatio float64
+	}{
+		{"off", Options{}, 0, 0.5},
+		{"default window", Options{AutoGain: true}, 0.9, 1.1},
+		{"short window", Options{AutoGain: true, AutoGainWindow: 0.25}, 0.9, 1.1},
+	}
+
+	for _, tt := range tests {
+		samples, rate, err := MIDIToFloat32(bytes.NewReader(data), tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		solo := peak(samples, rate, 0.5, 1.5)
+		dense := peak(samples, rate, 3.5, 4.5)
+		if ratio := solo / dense; ratio < tt.minRatio || ratio > tt.maxRatio {
+			t.Errorf("%s: solo peak %v, chord peak %v, want a ratio in [%v, %v]", tt.name, solo, dense, tt.minRatio, tt.maxRatio)
+		}
+		if all := peak(samples, rate, 0, float64(len(samples))/float64(rate)); all > 1 {
+			t.Errorf("%s: peak %v, want <= 1", tt.name, all)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"math"
+	"sort"
+)
+
+// PitchBend decides how pitchBend events change the pitch of the sounding notes
+type PitchBend int
+
+const (
+	// PitchBendIgnore renders every note at its own pitch
+	PitchBendIgnore PitchBend = iota
+	// PitchBendStep changes the pitch at each pitchBend event
+	PitchBendStep
+	// PitchBendLinear glides the pitch linearly from each pitchBend event to the next
+	// (e.g. to smooth bends sent at a low rate)
+	PitchBendLinear
+)
+
+const (
+	// pitchBendCenter is the value of pitchBend events leaving the pitch unchanged
+	pitchBendCenter = 8192
+	// defaultPitchBendRange is the bend in semitones of a full pitchBend event
+	// of General MIDI
+	defaultPitchBendRange = 2
+)
+
+// bendPoint is a change of the pitch of a note
+type bendPoint struct {
+	// time in seconds from the start of the note
+	time  float64
+	cents float32
+}
+
+// bendCents converts the value of a pitchBend event (0 to 16383)
+// into cents bending up or down by at most semitones
+func bendCents(value int, semitones float32) float32 {
+	return float32(value-pitchBendCenter) / pitchBendCenter * semitones * 100
+}
+
+// bendAt returns the bend in cents at time (in seconds from the start of the note)
+func (b PitchBend) bendAt(points []bendPoint, time float64) float32 {
+	k := sort.Search(len(points), func(i int) bool {
+		return points[i].time > time
+	}) - 1
+	if k < 0 {
+		return 0
+	}
+
+	cents := points[k].cents
+	if b == PitchBendLinear && k+1 < len(points) {
+		if span := points[k+1].time - points[k].time; span > 0 {
+			x := float32((time - points[k].time) / span)
+			cents += (points[k+1].cents - cents) * x
+		}
+	}
+	return cents
+}
+
+// bentWave returns the generator of a tone of the frequency in Hz
+// bent by points in the same way as toneWave
+// (the phase is accumulated so that the tone glides without jumps)
+func (w *wavData) bentWave(frequency float32, elapsed int, offset float64, bend PitchBend, points []bendPoint) func(i int) float32 {
+	var (
+		// cycles per sample without bend
+		step  = float64(frequency) / float64(w.sampleRate)
+		phase = w.waveform.startPhase() + offset + step*float64(elapsed)
+		next  = 0
+	)
+
+	if step <= 0 {
+		return nil
+	}
+	// samples are generated in order
+	return func(i int) float32 {
+		for ; next < i; next++ {
+			cents := bend.bendAt(points, float64(next)/float64(w.sampleRate))
+			phase += step * math.Pow(2, float64(cents)/1200)
+		}
+		return w.waveform.sample(phase, w.squareDuty)
+	}
+}
+
+// noteWave returns the generator of a tone of the frequency in Hz
+// bent by points unless pitch bend is ignored in the same way as toneWave
+func (w *wavData) noteWave(frequency float32, elapsed int, offset float64, points []bendPoint) func(i int) float32 {
+	if w.pitchBend == PitchBendIgnore || len(points) == 0 {
+		return w.toneWave(frequency, elapsed, offset)
+	}
+	return w.bentWave(frequency, elapsed, offset, w.pitchBend, points)
+}
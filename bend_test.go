@@ -0,0 +1,136 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestBendAt(t *testing.T) {
+	points := []bendPoint{{0.2, 0}, {0.4, 200}, {0.8, -100}}
+
+	tests := []struct {
+		bend PitchBend
+		time float64
+		want float32
+	}{
+		{PitchBendStep, 0.1, 0},
+		{PitchBendStep, 0.3, 0},
+		{PitchBendStep, 0.4, 200},
+		{PitchBendStep, 0.7, 200},
+		{PitchBendStep, 1, -100},
+		{PitchBendLinear, 0.1, 0},
+		{PitchBendLinear, 0.3, 100},
+		{PitchBendLinear, 0.5, 125},
+		{PitchBendLinear, 0.8, -100},
+		{PitchBendLinear, 1, -100},
+	}
+
+	for _, tt := range tests {
+		if got := tt.bend.bendAt(points, tt.time); math.Abs(float64(got-tt.want)) > 1e-3 {
+			t.Errorf("bendAt(%v) of PitchBend %d = %v, want %v", tt.time, tt.bend, got, tt.want)
+		}
+	}
+}
+
+func TestBendCents(t *testing.T) {
+	tests := []struct {
+		value     int
+		semitones float32
+		want      float32
+	}{
+		{8192, 2, 0},
+		{0, 2, -200},
+		{16383, 2, 199.98},
+		{12288, 2, 100},
+		{0, 12, -1200},
+	}
+
+	for _, tt := range tests {
+		if got := bendCents(tt.value, tt.semitones); math.Abs(float64(got-tt.want)) > 0.01 {
+			t.Errorf("bendCents(%d, %v) = %v, want %v", tt.value, tt.semitones, got, tt.want)
+		}
+	}
+}
+
+func TestContinuousBend(t *testing.T) {
+	// A4 held for a second bent up by 2 semitones in 10 steps of 0.1 seconds
+	events := [][]byte{noteOn(0, 69, 100)}
+	for k := 0; k <= 10; k++ {
+		delta := uint(96)
+		if k == 0 {
+			delta = 0
+		}
+		value := 8192 + k*819
+		events = append(events, event(delta, 0xe0, byte(value&0x7f), byte(value>>7)))
+	}
+	events = append(events, noteOff(0, 69))
+	data := smf(0, 480, track(events...))
+
+	// frequency measures the rising zero crossings between the seconds
+	frequency := func(samples []float32, rate uint32, from, to float64) float64 {
+		var first, last float64
+		crossings := 0
+		for i := int(from * float64(rate)); i < int(to*float64(rate)); i++ {
+			a, b := samples[i-1], samples[i]
+			if a < 0 && b >= 0 {
+				x := float64(i-1) + float64(-a/(b-a))
+				if crossings == 0 {
+					first = x
+				}
+				last = x
+				crossings++
+			}
+		}
+		return float64(crossings-1) / (last - first) * float64(rate)
+	}
+	// pitch returns the frequency of A4 bent by cents
+	pitch := func(cents float64) float64 {
+		return 440 * math.Pow(2, cents/1200)
+	}
+
+	tests := []struct {
+		name string
+		bend PitchBend
+		// bend points of the note
+		points int
+		// cents of the bend at time in seconds
+		cents func(time float64) float64
+	}{
+		{"ignored", PitchBendIgnore, 0, func(float64) float64 { return 0 }},
+		{"steps", PitchBendStep, 11, func(time float64) float64 { return math.Floor(time*10) * 819 / 8192 * 200 }},
+		{"linear", PitchBendLinear, 11, func(time float64) float64 { return time * 10 * 819 / 8192 * 200 }},
+	}
+
+	for _, tt := range tests {
+		if points := len(collect(t, data, Options{PitchBend: tt.bend})[0].bend); points != tt.points {
+			t.Errorf("%s: got %d bend points, want %d", tt.name, points, tt.points)
+		}
+
+		samples, rate, err := MIDIToFloat32(bytes.NewReader(data), Options{PitchBend: tt.bend})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for _, window := range [][2]float64{{0.02, 0.08}, {0.42, 0.48}, {0.72, 0.78}} {
+			// the linear bend at the middle of the window is its average
+			want := pitch(tt.cents((window[0] + window[1]) / 2))
+			if got := frequency(samples, rate, window[0], window[1]); math.Abs(got-want) > 0.5 {
+				t.Errorf("%s: frequency between %v and %v seconds = %.2f Hz, want %.2f Hz", tt.name, window[0], window[1], got, want)
+			}
+		}
+	}
+}
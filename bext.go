@@ -0,0 +1,51 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "encoding/binary"
+
+// BroadcastExtension holds the fields of a Broadcast Wave Format bext chunk.
+// Fields longer than their size in the chunk are truncated.
+type BroadcastExtension struct {
+	// Description of the sound (up to 256 characters, the track name if empty)
+	Description string
+	// Originator is the name of the producer (up to 32 characters)
+	Originator string
+	// OriginatorReference is the reference of the producer (up to 32 characters)
+	OriginatorReference string
+	// OriginationDate is formatted as "yyyy-mm-dd"
+	OriginationDate string
+	// OriginationTime is formatted as "hh:mm:ss"
+	OriginationTime string
+}
+
+// bext chunk version 1 has a fixed size of 602 bytes without coding history
+const bextLength = 602
+
+// bytes encodes the fields into the data of a bext chunk
+func (b *BroadcastExtension) bytes() []byte {
+	data := make([]byte, bextLength)
+
+	copy(data[0:256], b.Description)
+	copy(data[256:288], b.Originator)
+	copy(data[288:320], b.OriginatorReference)
+	copy(data[320:330], b.OriginationDate)
+	copy(data[330:338], b.OriginationTime)
+	// time reference (8 bytes) is zero
+	binary.LittleEndian.PutUint16(data[346:348], 1) // version
+	// UMID and reserved bytes are zero
+
+	return data
+}
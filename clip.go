@@ -0,0 +1,127 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"math"
+	"sort"
+)
+
+// clip keeps the notes sounding between start and end (in seconds)
+// cutting the overlapping notes at the edges and moving start to zero
+// (end is unlimited if not positive)
+func clip(notes []*progression, start, end float64) []*progression {
+	if end <= 0 {
+		end = math.Inf(1)
+	}
+
+	clipped := make([]*progression, 0, len(notes))
+	for _, note := range notes {
+		from := math.Max(note.offset, start)
+		to := math.Min(note.offset+note.time, end)
+		if to <= from {
+			continue
+		}
+
+		// each note is faded in and out so the cut edges do not click
+		n := *note
+		n.offset = from - start
+		n.elapsed += from - note.offset
+		n.time = to - from
+		n.envelope = clipEnvelope(note.envelope, from-note.offset)
+		n.bend = clipBend(note.bend, from-note.offset)
+		clipped = append(clipped, &n)
+	}
+
+	return clipped
+}
+
+// clipEnvelope moves the points of envelope earlier by time in seconds
+// dropping the points which no longer change the gain after time
+func clipEnvelope(points []gainPoint, time float64) []gainPoint {
+	if time <= 0 || len(points) == 0 {
+		return points
+	}
+
+	// the gain ramps from the point before the last one passed
+	k := sort.Search(len(points), func(i int) bool {
+		return points[i].time > time
+	}) - 2
+	k = maxInt(k, 0)
+
+	clipped := make([]gainPoint, 0, len(points)-k)
+	for _, point := range points[k:] {
+		clipped = append(clipped, gainPoint{time: point.time - time, gain: point.gain})
+	}
+	return clipped
+}
+
+// clipBend moves the points of bend earlier by time in seconds
+// dropping the points which no longer change the pitch after time
+func clipBend(points []bendPoint, time float64) []bendPoint {
+	if time <= 0 || len(points) == 0 {
+		return points
+	}
+
+	// the pitch glides from the last point passed
+	k := sort.Search(len(points), func(i int) bool {
+		return points[i].time > time
+	}) - 1
+	k = maxInt(k, 0)
+
+	clipped := make([]bendPoint, 0, len(points)-k)
+	for _, point := range points[k:] {
+		clipped = append(clipped, bendPoint{time: point.time - time, cents: point.cents})
+	}
+	return clipped
+}
+
+// progressionStart returns the time in seconds where the first note starts
+func progressionStart(notes []*progression) float64 {
+	if len(notes) == 0 {
+		return 0
+	}
+	start := math.Inf(1)
+	for _, note := range notes {
+		start = math.Min(start, note.offset)
+	}
+	return start
+}
+
+// shift moves notes later by time in seconds
+func shift(notes []*progression, time float64) []*progression {
+	for _, note := range notes {
+		note.offset += time
+	}
+	return notes
+}
+
+// loop repeats the notes between start and end (in seconds) for count times
+// cutting the notes sounding across start and end
+func loop(notes []*progression, start, end float64, count int) []*progression {
+	if count <= 1 || end <= start {
+		return notes
+	}
+	length := end - start
+
+	looped := make([]*progression, 0, len(notes)*count)
+	if start > 0 {
+		looped = append(looped, clip(notes, 0, start)...)
+	}
+	for i := 0; i < count; i++ {
+		looped = append(looped, shift(clip(notes, start, end), start+float64(i)*length)...)
+	}
+	return append(looped, shift(clip(notes, end, 0), end+float64(count-1)*length)...)
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"math"
+	"testing"
+)
+
+func TestClipPoints(t *testing.T) {
+	// a note from 1 to 3 seconds swelling at 1.5 and bent from before its start
+	note := &progression{
+		note:     "A4",
+		offset:   1,
+		time:     2,
+		envelope: []gainPoint{{0, 0.25}, {0.5, 0.5}, {1, 1}},
+		bend:     []bendPoint{{-0.5, 100}, {0.5, 200}, {1.5, -100}},
+	}
+
+	tests := []struct {
+		name       string
+		start, end float64
+		// seconds of the note cut from its start
+		cut      float64
+		envelope int
+		bend     int
+	}{
+		{name: "uncut", start: 0, end: 0, cut: 0, envelope: 3, bend: 3},
+		{name: "cut before the swell", start: 1.25, end: 0, cut: 0.25, envelope: 3, bend: 3},
+		{name: "cut during the swell", start: 1.75, end: 0, cut: 0.75, envelope: 3, bend: 2},
+		{name: "cut after the swell", start: 2.25, end: 0, cut: 1.25, envelope: 2, bend: 2},
+		{name: "cut after the bends", start: 2.75, end: 0, cut: 1.75, envelope: 2, bend: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clipped := clip([]*progression{note}, tt.start, tt.end)
+			if len(clipped) != 1 {
+				t.Fatalf("clip() kept %d notes, want 1", len(clipped))
+			}
+			n := clipped[0]
+			if len(n.envelope) != tt.envelope || len(n.bend) != tt.bend {
+				t.Errorf("clip() kept %d envelope and %d bend points, want %d and %d", len(n.envelope), len(n.bend), tt.envelope, tt.bend)
+			}
+
+			// the gain and the pitch sound the same from the clipped start
+			for time := 0.0; time < n.time; time += 0.01 {
+				if got, want := envelopeGain(n.envelope, time), envelopeGain(note.envelope, time+tt.cut); math.Abs(float64(got-want)) > 1e-6 {
+					t.Errorf("gain at %.2f seconds = %v, want %v", time, got, want)
+				}
+				for _, bend := range []PitchBend{PitchBendStep, PitchBendLinear} {
+					if got, want := bend.bendAt(n.bend, time), bend.bendAt(note.bend, time+tt.cut); math.Abs(float64(got-want)) > 1e-3 {
+						t.Errorf("bend of PitchBend %d at %.2f seconds = %v, want %v", bend, time, got, want)
+					}
+				}
+			}
+		})
+	}
+
+	// the points of the note are left unchanged for the next clips
+	if note.envelope[0].time != 0 || note.bend[0].time != -0.5 {
+		t.Errorf("clip() changed the points of the note to %v and %v", note.envelope, note.bend)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "math"
+
+// delayChannel delays a single channel by time in seconds
+// extending the sound data to keep the tail of the delayed channel
+func (w *wavData) delayChannel(channel int, time float32) {
+	numChannels := int(w.numChannels)
+	if channel < 0 || channel >= numChannels {
+		return
+	}
+
+	delay := int(math.Round(float64(w.sampleRate) * float64(time)))
+	if delay <= 0 {
+		return
+	}
+
+	frames := w.length / numChannels
+	w.length = (frames + delay) * numChannels
+	w.grow(w.length)
+
+	// move backwards so that samples are not overwritten before they are read
+	for i := frames + delay - 1; i >= 0; i-- {
+		var d float32
+		if i >= delay {
+			d = w.data[(i-delay)*numChannels+channel]
+		}
+		w.data[i*numChannels+channel] = d
+	}
+
+	w.updateSizes()
+}
+
+// midSide encodes the left and right channels of stereo sound data
+// into mid (L+R)/2 and side (L-R)/2 which decode back by M+S and M-S
+func (w *wavData) midSide() {
+	if w.numChannels != 2 {
+		return
+	}
+
+	for i := 0; i+1 < w.length; i += 2 {
+		l, r := w.data[i], w.data[i+1]
+		w.data[i] = (l + r) / 2
+		w.data[i+1] = (l - r) / 2
+	}
+}
+
+// bus returns empty sound data with the format and the settings of w
+// (e.g. to render an effect send)
+func (w *wavData) bus() *wavData {
+	b := *w
+	b.header = append([]byte{}, w.header...)
+	b.data = nil
+	b.samples = nil
+	b.storageErrs = nil
+	b.length = 0
+	b.pointer = 0
+	b.updateSizes()
+	return &b
+}
+
+// mix adds the sound data of b (a bus of w) to w
+// extending w if b is longer
+func (w *wavData) mix(b *wavData) {
+	if b.length > w.length {
+		w.grow(b.length)
+		for i := w.length; i < b.length; i++ {
+			w.data[i] = 0
+		}
+		w.length = b.length
+		w.updateSizes()
+	}
+	for i, d := range b.data[:b.length] {
+		w.data[i] += d
+	}
+}
+
+// sendProgression returns the notes scaled by the send level of their MIDI channel
+// (1 for channels without a level) leaving out the notes not sent
+func sendProgression(notes []*progression, levels map[int]float32) []*progression {
+	sent := make([]*progression, 0, len(notes))
+	for _, note := range notes {
+		level, ok := levels[note.channel]
+		if !ok {
+			level = 1
+		}
+		if level <= 0 {
+			continue
+		}
+
+		n := *note
+		n.amplitude *= float32(math.Min(float64(level), 1))
+		sent = append(sent, &n)
+	}
+	return sent
+}
+
+// convolveReverb mixes the sound data of send (which may be w itself)
+// convolved with the impulse response ir at the wet level (0 to 1)
+// into the dry sound data extending it by the tail of the reverb
+// (ir is scaled to unit energy per channel so that the level of the reverb
+// does not depend on the level at which the impulse response was recorded)
+func (w *wavData) convolveReverb(ir *wavData, send *wavData, wet float32) {
+	ir.resample(w.sampleRate, InterpolationSinc)
+
+	var (
+		numChannels = int(w.numChannels)
+		frames      = w.length / numChannels
+		sendFrames  = send.length / numChannels
+		irChannels  = int(ir.numChannels)
+		irFrames    = ir.length / irChannels
+	)
+	if frames == 0 || irFrames == 0 {
+		return
+	}
+
+	// impulse response of each output channel
+	// mixed down to mono unless the numbers of channels match
+	responses := make([][]float32, numChannels)
+	for c := range responses {
+		h := make([]float32, irFrames)
+		for i := range h {
+			if irChannels == numChannels {
+				h[i] = ir.data[i*irChannels+c]
+				continue
+			}
+			for j := 0; j < irChannels; j++ {
+				h[i] += ir.data[i*irChannels+j] / float32(irChannels)
+			}
+		}
+		responses[c] = h
+	}
+
+	var energy float64
+	for _, h := range responses {
+		for _, d := range h {
+			energy += float64(d) * float64(d)
+		}
+	}
+	if energy == 0 {
+		return
+	}
+	scale := float32(1 / math.Sqrt(energy/float64(numChannels)))
+	for _, h := range responses {
+		for i := range h {
+			h[i] *= scale
+		}
+	}
+
+	data, file := w.makeSamples(maxInt(frames, sendFrames+irFrames-1) * numChannels)
+	x := make([]float32, sendFrames)
+	for c, h := range responses {
+		for i := 0; i < frames; i++ {
+			data[i*numChannels+c] = w.data[i*numChannels+c] * (1 - wet)
+		}
+
+		if sendFrames == 0 {
+			continue
+		}
+		for i := range x {
+			x[i] = send.data[i*numChannels+c]
+		}
+		for i, y := range convolve(x, h) {
+			data[i*numChannels+c] += y * wet
+		}
+	}
+
+	w.setSamples(data, file)
+	w.length = len(data)
+	w.updateSizes()
+}
+
+// DownmixMode decides how channels are mixed down to mono
+type DownmixMode int
+
+const (
+	// DownmixAverage averages all channels
+	DownmixAverage DownmixMode = iota
+	// DownmixFirstChannel keeps only the first channel
+	// (e.g. when the channels cancel out on averaging)
+	DownmixFirstChannel
+)
+
+// correlation returns the correlation of the first two channels (-1 to 1)
+// which is negative when they cancel out on averaging (1 for mono)
+func (w *wavData) correlation() float64 {
+	numChannels := int(w.numChannels)
+	if numChannels < 2 {
+		return 1
+	}
+
+	var sum, left, right float64
+	for i := 0; i+1 < w.length; i += numChannels {
+		l, r := float64(w.data[i]), float64(w.data[i+1])
+		sum += l * r
+		left += l * l
+		right += r * r
+	}
+
+	if left == 0 || right == 0 {
+		return 1
+	}
+	return sum / math.Sqrt(left*right)
+}
+
+// downmix mixes the channels down to a single channel
+func (w *wavData) downmix(mode DownmixMode) {
+	numChannels := int(w.numChannels)
+	if numChannels < 2 {
+		return
+	}
+
+	frames := w.length / numChannels
+	data, file := w.makeSamples(frames)
+	for i := range data {
+		switch mode {
+		case DownmixFirstChannel:
+			data[i] = w.data[i*numChannels]
+		default:
+			for c := 0; c < numChannels; c++ {
+				data[i] += w.data[i*numChannels+c] / float32(numChannels)
+			}
+		}
+	}
+
+	w.setSamples(data, file)
+	w.length = frames
+	w.numChannels = 1
+	w.channelMask = defaultChannelMask(1)
+	w.pointer /= uint(numChannels)
+	w.updateSizes()
+}
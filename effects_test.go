@@ -0,0 +1,293 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestConvolveReverbNormalizesImpulseResponse(t *testing.T) {
+	// newData returns sound data of the channels holding frames
+	newData := func(t *testing.T, numChannels uint16, frames [][]float32) *wavData {
+		t.Helper()
+		w, err := newWAV(wavFormatPCM, numChannels, 44100, 16, true, make([]byte, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, frame := range frames {
+			w.data = append(w.data, frame...)
+		}
+		w.length = len(w.data)
+		return w
+	}
+
+	// decaying response of 64 frames at level
+	response := func(numChannels int, level float32) [][]float32 {
+		frames := make([][]float32, 64)
+		for i := range frames {
+			frames[i] = make([]float32, numChannels)
+			for c := range frames[i] {
+				frames[i][c] = level * float32(math.Exp(-float64(i)/8))
+			}
+		}
+		return frames
+	}
+
+	tests := []struct {
+		name       string
+		channels   uint16
+		irChannels int
+		level      float32
+	}{
+		{name: "quiet", channels: 1, irChannels: 1, level: 0.01},
+		{name: "loud", channels: 1, irChannels: 1, level: 1},
+		{name: "stereo", channels: 2, irChannels: 2, level: 0.3},
+		{name: "stereo mixed down", channels: 1, irChannels: 2, level: 0.8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a unit impulse on every channel
+			impulse := [][]float32{make([]float32, tt.channels)}
+			for c := range impulse[0] {
+				impulse[0][c] = 1
+			}
+			w := newData(t, tt.channels, impulse)
+			ir := newData(t, uint16(tt.irChannels), response(tt.irChannels, tt.level))
+
+			const wet = 0.5
+			w.convolveReverb(ir, w, wet)
+
+			// the wet impulse response carries wet^2 of energy per channel
+			// in addition to the dry impulse
+			var energy float64
+			for i, d := range w.data[:w.length] {
+				if i < int(tt.channels) {
+					d -= 1 - wet
+				}
+				energy += float64(d) * float64(d)
+			}
+			energy /= float64(tt.channels)
+			if math.Abs(energy-wet*wet) > 1e-4 {
+				t.Errorf("reverb energy = %g, want %g", energy, wet*wet)
+			}
+		})
+	}
+}
+
+func TestDownmix(t *testing.T) {
+	tests := []struct {
+		name        string
+		numChannels uint16
+		data        []float32
+		mode        DownmixMode
+		want        []float32
+	}{
+		{name: "average", numChannels: 2, data: []float32{1, -1, 0.5, 0.25}, mode: DownmixAverage, want: []float32{0, 0.375}},
+		{name: "first channel", numChannels: 2, data: []float32{1, -1, 0.5, 0.25}, mode: DownmixFirstChannel, want: []float32{1, 0.5}},
+		{name: "average of 3 channels", numChannels: 3, data: []float32{0.3, 0.6, 0.9, -0.3, 0, 0}, mode: DownmixAverage, want: []float32{0.6, -0.1}},
+		{name: "first of 3 channels", numChannels: 3, data: []float32{0.3, 0.6, 0.9, -0.3, 0, 0}, mode: DownmixFirstChannel, want: []float32{0.3, -0.3}},
+		{name: "mono", numChannels: 1, data: []float32{0.2, -0.4}, mode: DownmixAverage, want: []float32{0.2, -0.4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := newWAV(wavFormatPCM, tt.numChannels, 44100, 16, true, make([]byte, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.data = append([]float32(nil), tt.data...)
+			w.length = len(tt.data)
+			w.updateSizes()
+
+			w.downmix(tt.mode)
+
+			if w.numChannels != 1 || w.length != len(tt.want) {
+				t.Fatalf("%d channels of %d samples, want 1 channel of %d samples", w.numChannels, w.length, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if math.Abs(float64(w.data[i]-want)) > 1e-6 {
+					t.Errorf("sample %d = %g, want %g", i, w.data[i], want)
+				}
+			}
+			if err := w.validateHeader(); err != nil {
+				t.Errorf("validateHeader() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestCorrelation(t *testing.T) {
+	tests := []struct {
+		name string
+		data []float32
+		want float64
+	}{
+		{name: "in phase", data: []float32{0.5, 0.5, -0.25, -0.25, 1, 1}, want: 1},
+		{name: "out of phase", data: []float32{0.5, -0.5, -0.25, 0.25, 1, -1}, want: -1},
+		{name: "one silent channel", data: []float32{0.5, 0, -0.25, 0, 1, 0}, want: 1},
+		{name: "uncorrelated", data: []float32{1, 1, 1, -1}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := newWAV(wavFormatPCM, 2, 44100, 16, true, make([]byte, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.data = tt.data
+			w.length = len(tt.data)
+
+			if got := w.correlation(); math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("correlation() = %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReverbSend(t *testing.T) {
+	// a note of channel 0 and a later note of channel 1 of the same level
+	data := smf(0, 480, track(
+		event(0, 0x90, 69, 100), event(480, 0x80, 69, 0),
+		event(960, 0x91, 69, 100), event(480, 0x81, 69, 0),
+	))
+
+	// the impulse response is an echo after 0.25 seconds
+	// heard alone after the end of each note
+	ir, err := newWAV(wavFormatPCM, 1, 44100, 16, true, make([]byte, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ir.data = make([]float32, 44100/2)
+	ir.data[44100/4] = 0.5
+	ir.length = len(ir.data)
+	ir.updateSizes()
+	response := ir.toBuffer().Bytes()
+
+	// peak returns the peak of samples between the seconds
+	// (the output ends with the last note if it is not fed to the reverb)
+	peak := func(samples []float32, rate uint32, from, to float64) float64 {
+		var p float64
+		end := minInt(int(to*float64(rate)), len(samples))
+		for _, s := range samples[minInt(int(from*float64(rate)), end):end] {
+			p = math.Max(p, math.Abs(float64(s)))
+		}
+		return p
+	}
+
+	tests := []struct {
+		name  string
+		sends map[int]float32
+		// levels of the echoes of channels 0 and 1 relative to the echo without sends
+		echoes [2]float64
+	}{
+		{"no sends", nil, [2]float64{1, 1}},
+		{"dry channel 0", map[int]float32{0: 0}, [2]float64{0, 1}},
+		{"dry channel 1", map[int]float32{1: 0}, [2]float64{1, 0}},
+		{"half of channel 1", map[int]float32{0: 1, 1: 0.5}, [2]float64{1, 0.5}},
+		{"another channel", map[int]float32{5: 0}, [2]float64{1, 1}},
+	}
+
+	var reference float64
+	for _, tt := range tests {
+		samples, rate, err := MIDIToFloat32(bytes.NewReader(data), Options{ImpulseResponse: response, ReverbSend: tt.sends})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		echoes := [2]float64{peak(samples, rate, 0.55, 0.75), peak(samples, rate, 2.05, 2.25)}
+		if tt.sends == nil {
+			reference = echoes[0]
+			if reference < 0.1 {
+				t.Fatalf("%s: echo of %v, want an audible echo", tt.name, reference)
+			}
+		}
+		for c, echo := range echoes {
+			if math.Abs(echo/reference-tt.echoes[c]) > 0.02 {
+				t.Errorf("%s: echo of channel %d at %v, want %v", tt.name, c, echo/reference, tt.echoes[c])
+			}
+		}
+	}
+}
+
+func TestMidSide(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels uint16
+		data     []float32
+		want     []float32
+	}{
+		{"centered", 2, []float32{1, 1, -0.5, -0.5}, []float32{1, 0, -0.5, 0}},
+		{"out of phase", 2, []float32{1, -1}, []float32{0, 1}},
+		{"left only", 2, []float32{0.5, 0, 0, 0.25}, []float32{0.25, 0.25, 0.125, -0.125}},
+		{"mono", 1, []float32{1, -1, 0.5}, []float32{1, -1, 0.5}},
+		{"3 channels", 3, []float32{1, 0, 0.5}, []float32{1, 0, 0.5}},
+	}
+
+	for _, tt := range tests {
+		w, err := newWAV(wavFormatPCM, tt.channels, 44100, 16, true, make([]byte, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.data = append([]float32(nil), tt.data...)
+		w.length = len(w.data)
+
+		w.midSide()
+		for i := range tt.want {
+			if w.data[i] != tt.want[i] {
+				t.Errorf("%s: sample %d = %v, want %v", tt.name, i, w.data[i], tt.want[i])
+			}
+		}
+
+		// left and right are mid plus side and mid minus side
+		if tt.channels != 2 {
+			continue
+		}
+		for i := 0; i < len(tt.data); i += 2 {
+			m, s := w.data[i], w.data[i+1]
+			if m+s != tt.data[i] || m-s != tt.data[i+1] {
+				t.Errorf("%s: frame %d decodes to %v, %v, want %v, %v", tt.name, i/2, m+s, m-s, tt.data[i], tt.data[i+1])
+			}
+		}
+	}
+
+	// rendered channels which differ by the phases of PhaseSpread
+	data := smf(0, 480, track(noteOn(0, 69, 100), noteOff(480, 69)))
+	opts := Options{Channels: 2, PhaseSpread: 1}
+	stereo, _, err := MIDIToFloat32(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.MidSide = true
+	encoded, _, err := MIDIToFloat32(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encoded) != len(stereo) {
+		t.Fatalf("MidSide rendered %d samples, want %d", len(encoded), len(stereo))
+	}
+	var side float64
+	for i := 0; i < len(stereo); i += 2 {
+		m, s := encoded[i], encoded[i+1]
+		if math.Abs(float64(m+s-stereo[i])) > 1e-6 || math.Abs(float64(m-s-stereo[i+1])) > 1e-6 {
+			t.Fatalf("frame %d decodes to %v, %v, want %v, %v", i/2, m+s, m-s, stereo[i], stereo[i+1])
+		}
+		side = math.Max(side, math.Abs(float64(s)))
+	}
+	if side == 0 {
+		t.Errorf("MidSide rendered no side of channels that differ")
+	}
+}
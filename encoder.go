@@ -0,0 +1,140 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Format describes the rendered samples passed to an Encoder
+type Format struct {
+	// SampleRate is the number of frames per second
+	SampleRate uint32
+	// Channels is the number of interleaved samples in a frame
+	Channels int
+	// BitsPerSample is the requested resolution of the output (Options.BitsPerSample)
+	BitsPerSample int
+	// ChannelMask assigns the channels to speaker positions (none if zero)
+	ChannelMask uint32
+	// Float is true for floating point output (Options.FloatSamples)
+	Float bool
+}
+
+// Encoder writes rendered samples in an output format
+type Encoder interface {
+	// Encode writes the interleaved samples normalized to -1 to 1
+	Encode(samples []float32, format Format, w io.Writer) error
+}
+
+// WAVEncoder encodes samples into a PCM WAV
+// (WAVE_FORMAT_EXTENSIBLE if ChannelMask is set or there are more than 2 channels)
+// or into a 32-bit floating point WAV with a fact chunk if Float is set
+type WAVEncoder struct {
+	// BroadcastExtension adds a bext chunk if not nil
+	BroadcastExtension *BroadcastExtension
+	// Copyright adds a LIST chunk with the ICOP field of INFO if not empty
+	Copyright string
+	// ValidateHeader checks the consistency of the header before writing
+	// and returns ErrInvalidHeader without writing if it fails
+	ValidateHeader bool
+}
+
+// Encode writes the WAV of samples
+func (e WAVEncoder) Encode(samples []float32, format Format, w io.Writer) error {
+	if format.Channels <= 0 || format.Channels > 0xFFFF {
+		return fmt.Errorf("%w: %d channels", ErrUnsupportedFormat, format.Channels)
+	}
+
+	audioFormat := uint16(wavFormatPCM)
+	bitsPerSample := format.BitsPerSample
+	switch {
+	case format.Float:
+		audioFormat = wavFormatFloat
+		bitsPerSample = 32
+	case format.ChannelMask != 0:
+		audioFormat = wavFormatExtensible
+	}
+
+	wav, err := newWAV(audioFormat, uint16(format.Channels), format.SampleRate, bitsPerSample, true, make([]byte, 0))
+	if err != nil {
+		return err
+	}
+	if format.ChannelMask != 0 {
+		wav.channelMask = format.ChannelMask
+	}
+	if e.BroadcastExtension != nil {
+		wav.addChunk("bext", e.BroadcastExtension.bytes())
+	}
+	if e.Copyright != "" {
+		wav.addChunk("LIST", infoList(infoField{"ICOP", e.Copyright}))
+	}
+
+	// drop an incomplete frame
+	wav.data = samples
+	wav.length = len(samples) / format.Channels * format.Channels
+	wav.updateSizes()
+
+	if e.ValidateHeader {
+		if err := wav.validateHeader(); err != nil {
+			return err
+		}
+	}
+
+	_, err = wav.WriteTo(w)
+	return err
+}
+
+// format returns the format of the sound data for an Encoder
+func (w *wavData) format() Format {
+	f := Format{
+		SampleRate:    w.sampleRate,
+		Channels:      int(w.numChannels),
+		BitsPerSample: w.bitsPerSample,
+		Float:         w.audioFormat == wavFormatFloat,
+	}
+	// a mask is written only in the extensible format
+	if w.maskOffset > 0 {
+		f.ChannelMask = w.channelMask
+	}
+	return f
+}
+
+// encode writes the sound data with the encoder of opts
+// (a WAVEncoder with the chunks of the sound data if nil)
+func (w *wavData) encode(opts Options, writer io.Writer) error {
+	encoder := opts.Encoder
+	if encoder == nil {
+		encoder = WAVEncoder{
+			BroadcastExtension: w.bext,
+			Copyright:          w.copyright,
+			ValidateHeader:     opts.ValidateHeader,
+		}
+	}
+	return encoder.Encode(w.data[:w.length], w.format(), writer)
+}
+
+// encodeBuffer returns the sound data encoded by the encoder of opts
+func (w *wavData) encodeBuffer(opts Options) (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+	// room for the WAV of the default encoder
+	buf.Grow(len(w.header) + int(w.subChunk2Size))
+
+	if err := w.encode(opts, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// recordingEncoder writes the number of frames and the format of the samples
+type recordingEncoder struct {
+	calls *int
+}
+
+func (e recordingEncoder) Encode(samples []float32, format Format, w io.Writer) error {
+	*e.calls++
+	_, err := fmt.Fprintf(w, "%d frames at %d Hz", len(samples)/format.Channels, format.SampleRate)
+	return err
+}
+
+func TestEncoderOutputs(t *testing.T) {
+	data := smf(1, 480,
+		track(event(0, 0xff, 0x06, 0x01, 'A'), event(960, 0xff, 0x06, 0x01, 'B')),
+		track(noteOn(0, 60, 100), noteOff(960, 60), event(0, 0x91, 64, 100), event(960, 0x81, 64, 0)),
+	)
+
+	tests := []struct {
+		name    string
+		outputs int
+		convert func(opts Options) ([]*bytes.Buffer, error)
+	}{
+		{
+			name:    "Stems",
+			outputs: 2,
+			convert: func(opts Options) ([]*bytes.Buffer, error) {
+				stems, err := Stems(bytes.NewReader(data), opts)
+				var bufs []*bytes.Buffer
+				for _, b := range stems {
+					bufs = append(bufs, b)
+				}
+				return bufs, err
+			},
+		},
+		{
+			name:    "Sections",
+			outputs: 2,
+			convert: func(opts Options) ([]*bytes.Buffer, error) {
+				sections, err := Sections(bytes.NewReader(data), opts)
+				var bufs []*bytes.Buffer
+				for _, b := range sections {
+					bufs = append(bufs, b)
+				}
+				return bufs, err
+			},
+		},
+		{
+			name:    "ReferenceTone",
+			outputs: 1,
+			convert: func(opts Options) ([]*bytes.Buffer, error) {
+				b, err := ReferenceTone(440, 0.5, 1, opts)
+				return []*bytes.Buffer{b}, err
+			},
+		},
+		{
+			name:    "AuditionNote",
+			outputs: 1,
+			convert: func(opts Options) ([]*bytes.Buffer, error) {
+				b, err := AuditionNote(60, 100, 0.5, opts)
+				return []*bytes.Buffer{b}, err
+			},
+		},
+		{
+			name:    "MIDIToWAVWithOptions",
+			outputs: 1,
+			convert: func(opts Options) ([]*bytes.Buffer, error) {
+				b, err := MIDIToWAVWithOptions(bytes.NewReader(data), opts)
+				return []*bytes.Buffer{b}, err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			bufs, err := tt.convert(Options{Encoder: recordingEncoder{calls: &calls}, SampleRate: 22050})
+			if err != nil {
+				t.Fatalf("%s() error = %v", tt.name, err)
+			}
+			if calls != tt.outputs || len(bufs) != tt.outputs {
+				t.Fatalf("%d outputs by %d calls of the encoder, want %d", len(bufs), calls, tt.outputs)
+			}
+			for _, b := range bufs {
+				var frames int
+				var rate uint32
+				if _, err := fmt.Sscanf(b.String(), "%d frames at %d Hz", &frames, &rate); err != nil || frames == 0 || rate != 22050 {
+					t.Errorf("output %q is not written by the encoder", b.String())
+				}
+			}
+		})
+	}
+}
+
+func TestWAVEncoderValidateHeader(t *testing.T) {
+	// an incomplete frame at the end is dropped
+	samples := []float32{0, 0.5, -0.5, 1, -1, 0.25, 0.125}
+
+	tests := []struct {
+		name    string
+		encoder WAVEncoder
+		format  Format
+	}{
+		{"16-bit mono", WAVEncoder{}, Format{SampleRate: 44100, Channels: 1, BitsPerSample: 16}},
+		{"24-bit stereo", WAVEncoder{}, Format{SampleRate: 48000, Channels: 2, BitsPerSample: 24}},
+		{"float", WAVEncoder{}, Format{SampleRate: 44100, Channels: 2, BitsPerSample: 16, Float: true}},
+		{"channel mask", WAVEncoder{}, Format{SampleRate: 44100, Channels: 3, BitsPerSample: 16, ChannelMask: 0x7}},
+		{"chunks", WAVEncoder{BroadcastExtension: &BroadcastExtension{Description: "odd"}, Copyright: "(c) 2020"}, Format{SampleRate: 44100, Channels: 2, BitsPerSample: 16}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want bytes.Buffer
+			if err := tt.encoder.Encode(samples, tt.format, &want); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			// the checked header is the one written
+			var got bytes.Buffer
+			tt.encoder.ValidateHeader = true
+			if err := tt.encoder.Encode(samples, tt.format, &got); err != nil {
+				t.Fatalf("Encode() with ValidateHeader error = %v", err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Errorf("Encode() with ValidateHeader wrote %d bytes, want the same %d bytes", got.Len(), want.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "errors"
+
+// Errors returned by the package wrap one of these errors
+// with a detailed message and can be matched by errors.Is
+var (
+	// ErrInvalidHeader means the header or the chunks of the MIDI file
+	// (or the header of the WAV data) are malformed
+	ErrInvalidHeader = errors.New("invalid header")
+	// ErrUnsupportedFormat means the input or output format is not supported
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	// ErrTruncated means the data ended in the middle of a chunk or an event
+	ErrTruncated = errors.New("unexpected end of data")
+	// ErrInvalidEvent means an event of a track is malformed
+	ErrInvalidEvent = errors.New("invalid event")
+	// ErrInvalidNote means a note name or a note number cannot be converted
+	ErrInvalidNote = errors.New("invalid note")
+	// ErrInvalidAmplitude means an amplitude is outside of the normalized range
+	ErrInvalidAmplitude = errors.New("invalid amplitude")
+	// ErrTooLarge means the input or the output would exceed a configured limit
+	ErrTooLarge = errors.New("too large")
+	// ErrInvalidOption means an option or an argument is outside of its valid range
+	ErrInvalidOption = errors.New("invalid option")
+	// ErrOutOfPhase means the channels cancel out when they are downmixed
+	ErrOutOfPhase = errors.New("channels out of phase")
+)
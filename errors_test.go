@@ -0,0 +1,153 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestErrorsIs(t *testing.T) {
+	simple := smf(0, 480, track(noteOn(0, 69, 100), noteOff(480, 69)))
+
+	convert := func(data []byte, opts Options) func() error {
+		return func() error {
+			_, err := MIDIToWAVWithOptions(bytes.NewReader(data), opts)
+			return err
+		}
+	}
+
+	// warned collects the warnings of a conversion as a single error
+	warned := func(data []byte, opts Options) func() error {
+		return func() error {
+			var warnings []error
+			opts.Warn = func(err error) { warnings = append(warnings, err) }
+			if _, err := MIDIToWAVWithOptions(bytes.NewReader(data), opts); err != nil {
+				return err
+			}
+			if len(warnings) == 0 {
+				return nil
+			}
+			return warnings[0]
+		}
+	}
+
+	declared := smf(0, 480, track(noteOn(0, 69, 100), noteOff(480, 69)))
+	declared[11] = 2
+
+	tests := []struct {
+		name string
+		run  func() error
+		want error
+	}{
+		{
+			name: "not a MIDI file",
+			run:  convert([]byte("RIFF\x00\x00\x00\x06abcdef"), Options{}),
+			want: ErrInvalidHeader,
+		},
+		{
+			name: "truncated track",
+			run:  convert(simple[:len(simple)-6], Options{}),
+			want: ErrTruncated,
+		},
+		{
+			name: "tempo track out of range",
+			run:  convert(simple, Options{TempoTrack: 3}),
+			want: ErrInvalidOption,
+		},
+		{
+			name: "missing sequence",
+			run:  convert(simple, Options{SelectSequence: true, SequenceNumber: 5}),
+			want: ErrInvalidOption,
+		},
+		{
+			name: "reference tone without frequency",
+			run: func() error {
+				_, err := ReferenceTone(0, 1, 1, Options{})
+				return err
+			},
+			want: ErrInvalidOption,
+		},
+		{
+			name: "audition without velocity",
+			run: func() error {
+				_, err := AuditionNote(60, 0, 1, Options{})
+				return err
+			},
+			want: ErrInvalidOption,
+		},
+		{
+			name: "audition of a note out of range",
+			run: func() error {
+				_, err := AuditionNote(128, 100, 1, Options{})
+				return err
+			},
+			want: ErrInvalidNote,
+		},
+		{
+			name: "unknown note name",
+			run: func() error {
+				_, err := NoteNameToMIDI("H4")
+				return err
+			},
+			want: ErrInvalidNote,
+		},
+		{
+			name: "WAV header not matching the samples",
+			run: func() error {
+				w, err := newWAV(wavFormatPCM, 1, 44100, 16, true, make([]byte, 0))
+				if err != nil {
+					return err
+				}
+				w.writeTone(440, 0, 100, 1, []int{}, true, false)
+				w.header[40]++
+				return w.validateHeader()
+			},
+			want: ErrInvalidHeader,
+		},
+		{
+			name: "fewer tracks than declared",
+			run:  warned(declared, Options{}),
+			want: ErrTruncated,
+		},
+		{
+			name: "bytes after the last track",
+			run:  warned(append(append([]byte{}, simple...), 0, 0, 0), Options{}),
+			want: ErrInvalidHeader,
+		},
+		{
+			name: "channels cancelling out on downmix",
+			// half a period of 440 Hz inverts the delayed channel
+			run: warned(simple, Options{
+				Channels:          2,
+				HaasDelay:         1000.0 / 880,
+				HaasChannel:       1,
+				DownmixMono:       true,
+				DownmixCheckPhase: true,
+			}),
+			want: ErrOutOfPhase,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
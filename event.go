@@ -0,0 +1,175 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"io"
+	"sort"
+)
+
+// Event is a decoded MIDI event
+type Event struct {
+	// Delta is the time in ticks since the previous event
+	Delta uint
+	// Tick is the absolute time in ticks from the start of the track
+	Tick int
+	// Time is the absolute time in seconds given by the tempo map
+	// (zero for events decoded by ParseTrack)
+	Time float64
+	// Type is "channel", "meta", "sysEx", "dividedSysEx" or "unknown"
+	Type string
+	// SubType is the kind of channel or meta event (e.g. "noteOn" or "setTempo")
+	SubType string
+	// Value holds the decoded fields of the event by name (e.g. "noteNumber")
+	Value map[string]string
+	// Channel is the MIDI channel of a channel event
+	Channel int
+}
+
+func newEvent(event *midiEvent) *Event {
+	value := make(map[string]string, len(event.value))
+	for k, v := range event.value {
+		value[k] = v
+	}
+
+	return &Event{
+		Delta:   event.delta,
+		Tick:    event.tick,
+		Type:    event.eventType,
+		SubType: event.subType,
+		Value:   value,
+		Channel: int(event.channel),
+	}
+}
+
+// ParseTrack decodes the events in the data of a single MTrk chunk
+// (the bytes following the chunk id and the chunk length)
+func ParseTrack(data []byte) ([]*Event, error) {
+	track, _, err := readTrack(data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*Event, len(track))
+	for i, event := range track {
+		events[i] = newEvent(event)
+	}
+
+	return events, nil
+}
+
+// MetaHandler decodes the data of a meta event (e.g. sequencerSpecific)
+// into fields added to the Value of the event
+type MetaHandler func(data []byte) map[string]string
+
+// ParseMIDI decodes the events of every track of a MIDI file
+// with their absolute time given by the setTempo events of the first track
+func ParseMIDI(reader io.Reader) ([][]*Event, error) {
+	return ParseMIDIWithHandlers(reader, nil)
+}
+
+// ParseMIDIWithHandlers decodes MIDI in the same way as ParseMIDI
+// passing the data of meta events to the handler of their sub type byte
+// (e.g. 0x7f for sequencerSpecific)
+func ParseMIDIWithHandlers(reader io.Reader, metaHandlers map[byte]MetaHandler) ([][]*Event, error) {
+	midi, err := parseMIDIWithHandlers(reader, metaHandlers, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	timer, err := midi.timer(0)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := make([][]*Event, len(midi.tracks))
+	for i, track := range midi.tracks {
+		tracks[i] = make([]*Event, len(track))
+		for j, event := range track {
+			tracks[i][j] = newEvent(event)
+			tracks[i][j].Time = timer.Time(event.tick)
+		}
+	}
+
+	return tracks, nil
+}
+
+// TimedEvent is an event in the merged event stream of all tracks
+type TimedEvent struct {
+	// Track is the index of the track of the event
+	Track int
+	// Event is the event with Delta in ticks since the previous event of the stream
+	Event
+}
+
+// EventLog merges the channel events of all tracks in order of time
+// with meta events as well if includeMeta
+// (e.g. to diff two files or to feed a MIDI player)
+func EventLog(reader io.Reader, includeMeta bool) ([]TimedEvent, error) {
+	tracks, err := ParseMIDI(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]TimedEvent, 0)
+	for i, track := range tracks {
+		for _, event := range track {
+			if event.Type == "channel" || (includeMeta && event.Type == "meta") {
+				events = append(events, TimedEvent{
+					Track: i,
+					Event: *event,
+				})
+			}
+		}
+	}
+
+	// events at the same tick are kept in order of their tracks
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Tick < events[j].Tick
+	})
+
+	previous := 0
+	for i := range events {
+		events[i].Delta = uint(events[i].Tick - previous)
+		previous = events[i].Tick
+	}
+
+	return events, nil
+}
+
+// Chunk is a chunk of a MIDI file other than MThd and MTrk
+// (e.g. "XFIH" of Yamaha XF) which is skipped on conversion
+type Chunk struct {
+	ID   string
+	Data []byte
+}
+
+// ExtraChunks returns the chunks other than MThd and MTrk in order of the file
+func ExtraChunks(reader io.Reader) ([]Chunk, error) {
+	midi, err := parseMIDI(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make([]Chunk, len(midi.chunks))
+	for i, chunk := range midi.chunks {
+		chunks[i] = Chunk{
+			ID:   chunk.id,
+			Data: chunk.data,
+		}
+	}
+
+	return chunks, nil
+}
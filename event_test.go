@@ -0,0 +1,82 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseMIDITimes(t *testing.T) {
+	data := smf(1, 480,
+		track(tempo(0, 500000), tempo(960, 250000)),
+		track(noteOn(480, 60, 100), noteOff(480, 60), noteOn(240, 64, 100), noteOff(960, 64)),
+	)
+
+	type timing struct {
+		subType string
+		delta   uint
+		tick    int
+		time    float64
+	}
+
+	tests := []struct {
+		name  string
+		track int
+		want  []timing
+	}{
+		{
+			name:  "tempo track",
+			track: 0,
+			want: []timing{
+				{"setTempo", 0, 0, 0},
+				{"setTempo", 960, 960, 1},
+				{"endOfTrack", 0, 960, 1},
+			},
+		},
+		{
+			name:  "note track",
+			track: 1,
+			want: []timing{
+				{"noteOn", 480, 480, 0.5},
+				{"noteOff", 480, 960, 1},
+				// after the tempo doubles
+				{"noteOn", 240, 1200, 1.125},
+				{"noteOff", 960, 2160, 1.625},
+				{"endOfTrack", 0, 2160, 1.625},
+			},
+		},
+	}
+
+	tracks, err := ParseMIDI(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ParseMIDI() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := tracks[tt.track]
+			if len(events) != len(tt.want) {
+				t.Fatalf("track %d has %d events, want %d", tt.track, len(events), len(tt.want))
+			}
+			for i, e := range events {
+				got := timing{e.SubType, e.Delta, e.Tick, e.Time}
+				if got != tt.want[i] {
+					t.Errorf("event %d = %+v, want %+v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
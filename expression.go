@@ -0,0 +1,197 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"sort"
+	"strconv"
+)
+
+// controller numbers changing the volume of a MIDI channel
+const (
+	controllerVolume     = 7
+	controllerExpression = 11
+)
+
+// gainPoint is a change of the gain of a note
+type gainPoint struct {
+	// time in seconds from the start of the note
+	time float64
+	gain float32
+}
+
+// envelopeGain returns the gain at time (in seconds from the start of the note)
+// ramping over fadeSeconds at each change to prevent clicks
+func envelopeGain(points []gainPoint, time float64) float32 {
+	k := sort.Search(len(points), func(i int) bool {
+		return points[i].time > time
+	}) - 1
+	if k < 0 {
+		return 1
+	}
+
+	gain := points[k].gain
+	if x := (time - points[k].time) / fadeSeconds; k > 0 && x < 1 {
+		gain = points[k-1].gain + (gain-points[k-1].gain)*float32(x)
+	}
+	return gain
+}
+
+// channelExpression holds the controllers of a MIDI channel changing the volume
+// (full volume until received) and the pressure of aftertouch during a note
+type channelExpression struct {
+	volume     int
+	expression int
+	// pressure of aftertouch during the note (-1 until received)
+	pressure int
+}
+
+func newChannelExpression() channelExpression {
+	return channelExpression{
+		volume:     127,
+		expression: 127,
+		pressure:   -1,
+	}
+}
+
+// update applies a controller or an aftertouch event of the note of semitone
+// and reports whether it changes the volume
+func (c *channelExpression) update(event *midiEvent, semitone int) bool {
+	switch event.subType {
+	case "controller":
+		v, _ := strconv.Atoi(event.value["controllerValue"])
+		switch event.value["controllerNumber"] {
+		case strconv.Itoa(controllerVolume):
+			c.volume = v
+		case strconv.Itoa(controllerExpression):
+			c.expression = v
+		default:
+			return false
+		}
+	case "channelAftertouch":
+		c.pressure, _ = strconv.Atoi(event.value["value"])
+	case "noteAftertouch":
+		if event.value["noteNumber"] != strconv.Itoa(semitone) {
+			return false
+		}
+		c.pressure, _ = strconv.Atoi(event.value["amount"])
+	default:
+		return false
+	}
+	return true
+}
+
+// gain returns the gain of a note of velocity (up to 1)
+// where pressure of aftertouch during the note replaces its velocity
+func (c *channelExpression) gain(velocity int) float32 {
+	gain := float32(c.volume) / 127 * float32(c.expression) / 127
+	if c.pressure >= 0 && velocity > 0 {
+		gain *= float32(c.pressure) / float32(velocity)
+	}
+	// aftertouch harder than the velocity does not exceed the normalized level
+	if gain > 1 {
+		gain = 1
+	}
+	return gain
+}
+
+// channelChanges are the events of a MIDI channel changing the volume
+// in order of time with the controllers in effect after each of them
+type channelChanges struct {
+	events []*midiEvent
+	states []channelExpression
+}
+
+// expressionChanges collects the events changing the volume of each channel
+// from every track so that notes follow the controllers of their channel
+// wherever they are (e.g. in a track of their own)
+func (f *midiFile) expressionChanges() map[byte]*channelChanges {
+	changes := make(map[byte]*channelChanges)
+	for _, track := range f.tracks {
+		for _, event := range track {
+			switch event.subType {
+			case "controller", "channelAftertouch", "noteAftertouch":
+			default:
+				continue
+			}
+			c, ok := changes[event.channel]
+			if !ok {
+				c = &channelChanges{}
+				changes[event.channel] = c
+			}
+			c.events = append(c.events, event)
+		}
+	}
+
+	for _, c := range changes {
+		events := c.events
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].tick < events[j].tick
+		})
+
+		state := newChannelExpression()
+		c.states = make([]channelExpression, len(events))
+		for i, event := range events {
+			if event.subType == "controller" {
+				state.update(event, 0)
+			}
+			c.states[i] = state
+		}
+	}
+
+	return changes
+}
+
+// envelope returns the gain of a note of semitone at velocity
+// sounding from tick start to tick end at absolute time given by noteTime
+func (c *channelChanges) envelope(semitone, velocity, start, end int, noteTime func(tick uint) float64) []gainPoint {
+	state := newChannelExpression()
+	if c == nil {
+		return []gainPoint{{time: noteTime(uint(start)), gain: state.gain(velocity)}}
+	}
+
+	// controllers up to the start of the note
+	k := sort.Search(len(c.events), func(i int) bool {
+		return c.events[i].tick > start
+	})
+	if k > 0 {
+		state = c.states[k-1]
+	}
+
+	// aftertouch at the start of the note belongs to it
+	first := sort.Search(k, func(i int) bool {
+		return c.events[i].tick >= start
+	})
+	for _, event := range c.events[first:k] {
+		if event.subType != "controller" {
+			state.update(event, semitone)
+		}
+	}
+
+	points := []gainPoint{{time: noteTime(uint(start)), gain: state.gain(velocity)}}
+	for _, event := range c.events[k:] {
+		if event.tick >= end {
+			break
+		}
+		if state.update(event, semitone) {
+			points = append(points, gainPoint{
+				time: noteTime(uint(event.tick)),
+				gain: state.gain(velocity),
+			})
+		}
+	}
+
+	return points
+}
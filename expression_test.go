@@ -0,0 +1,159 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+// controller encodes a controller event of channel after delta ticks
+func controller(delta uint, channel, number, value byte) []byte {
+	return event(delta, 0xb0|channel, number, value)
+}
+
+func TestExpressionEnvelope(t *testing.T) {
+	held := track(noteOn(0, 60, 64), noteOff(1440, 60))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		envelope []gainPoint
+	}{
+		{
+			name: "swell in another track",
+			data: smf(1, 480,
+				track(controller(0, 0, controllerExpression, 32), controller(480, 0, controllerExpression, 64), controller(480, 0, controllerExpression, 127)),
+				held,
+			),
+			envelope: []gainPoint{{0, 32.0 / 127}, {0.5, 64.0 / 127}, {1, 1}},
+		},
+		{
+			name: "volume and expression",
+			data: smf(1, 480,
+				track(controller(0, 0, controllerVolume, 127), controller(0, 0, controllerExpression, 127), controller(720, 0, controllerVolume, 0)),
+				held,
+			),
+			envelope: []gainPoint{{0, 1}, {0.75, 0}},
+		},
+		{
+			name: "controllers of another channel",
+			data: smf(1, 480,
+				track(controller(0, 1, controllerExpression, 10), controller(480, 1, controllerVolume, 20)),
+				held,
+			),
+			envelope: []gainPoint{{0, 1}},
+		},
+		{
+			name: "controller before the note",
+			data: smf(1, 480,
+				track(controller(0, 0, controllerVolume, 0), controller(240, 0, controllerVolume, 127)),
+				track(noteOn(480, 60, 64), noteOff(480, 60)),
+			),
+			envelope: []gainPoint{{0, 1}},
+		},
+		{
+			name: "aftertouch up to the velocity",
+			data: smf(0, 480, track(
+				noteOn(0, 60, 64),
+				event(480, 0xd0, 32),
+				event(480, 0xd0, 127),
+				noteOff(480, 60),
+			)),
+			envelope: []gainPoint{{0, 1}, {0.5, 0.5}, {1, 1}},
+		},
+		{
+			name: "aftertouch of another note",
+			data: smf(0, 480, track(
+				noteOn(0, 60, 64),
+				event(480, 0xa0, 62, 16),
+				event(0, 0xa0, 60, 32),
+				noteOff(960, 60),
+			)),
+			envelope: []gainPoint{{0, 1}, {0.5, 0.5}},
+		},
+		{
+			name: "aftertouch before the note",
+			data: smf(0, 480, track(
+				event(0, 0xd0, 16),
+				noteOn(480, 60, 64),
+				noteOff(480, 60),
+			)),
+			envelope: []gainPoint{{0, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog := collect(t, tt.data, Options{Expression: true})
+			if len(prog) != 1 {
+				t.Fatalf("collected %d notes, want 1", len(prog))
+			}
+			envelope := prog[0].envelope
+			if len(envelope) != len(tt.envelope) {
+				t.Fatalf("envelope = %v, want %v", envelope, tt.envelope)
+			}
+			for i, want := range tt.envelope {
+				if math.Abs(envelope[i].time-want.time) > 1e-9 || math.Abs(float64(envelope[i].gain-want.gain)) > 1e-6 {
+					t.Errorf("point %d = %v, want %v", i, envelope[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSwellingNote(t *testing.T) {
+	// expression rising from a quarter to full volume in the middle of a note
+	data := smf(1, 480,
+		track(controller(0, 0, controllerExpression, 32), controller(960, 0, controllerExpression, 127)),
+		track(noteOn(0, 69, 64), noteOff(1920, 69)),
+	)
+
+	tests := []struct {
+		name       string
+		clipStart  float32
+		start, end float64
+		peak       float64
+	}{
+		{name: "before the swell", start: 0.1, end: 0.9, peak: 0.5 * 32 / 127},
+		{name: "after the swell", start: 1.1, end: 1.9, peak: 0.5},
+		// the swell moves with the start of the clipped note
+		{name: "clipped before the swell", clipStart: 0.5, start: 0.1, end: 0.4, peak: 0.5 * 32 / 127},
+		{name: "clipped after the swell", clipStart: 0.5, start: 0.6, end: 1.4, peak: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, _, err := MIDIToFloat32(bytes.NewReader(data), Options{
+				Expression:           true,
+				Waveform:             WaveformSine,
+				DisableNormalization: true,
+				ClipStart:            tt.clipStart,
+			})
+			if err != nil {
+				t.Fatalf("MIDIToFloat32() error = %v", err)
+			}
+
+			var peak float64
+			for _, s := range samples[int(tt.start*44100):int(tt.end*44100)] {
+				peak = math.Max(peak, math.Abs(float64(s)))
+			}
+			if math.Abs(peak-tt.peak) > 0.005 {
+				t.Errorf("peak = %g, want %g", peak, tt.peak)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "math"
+
+// fadeSeconds is the length of the fade at the start and the end of each note
+// to prevent sound artifacts
+const fadeSeconds = 0.001
+
+// FadeCurve is the shape of the fade at the start and the end of each note
+type FadeCurve int
+
+const (
+	// FadeLinear changes the gain linearly
+	FadeLinear FadeCurve = iota
+	// FadeExponential changes the gain exponentially (by 60 dB over the fade)
+	FadeExponential
+)
+
+// gain returns the gain at position x (0 to 1) of a fade-in
+func (c FadeCurve) gain(x float32) float32 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	switch c {
+	case FadeExponential:
+		return float32((math.Pow(1000, float64(x)) - 1) / 999)
+	default:
+		return x
+	}
+}
+
+// fadeOut fades the end of the sound data out over time in seconds
+func (w *wavData) fadeOut(time float32) {
+	var (
+		numChannels = int(w.numChannels)
+		frames      = w.length / numChannels
+		fade        = minInt(w.frame(float64(time)), frames)
+	)
+
+	for i := frames - fade; i < frames; i++ {
+		gain := w.fadeCurve.gain(float32(frames-i) / float32(fade+1))
+		for c := 0; c < numChannels; c++ {
+			w.data[i*numChannels+c] *= gain
+		}
+	}
+}
+
+// crossfade mixes the sound data before each seam (in seconds)
+// into the sound data before start with constant power over time in seconds
+// so that the sound continues into start (e.g. where a loop repeats)
+func (w *wavData) crossfade(start float64, seams []float64, time float64) {
+	var (
+		numChannels = int(w.numChannels)
+		frames      = w.length / numChannels
+		fade        = w.frame(time)
+		from        = w.frame(start) - fade
+	)
+	if fade <= 0 {
+		return
+	}
+
+	// copy the data leading into start before the seams overwrite it
+	// (silence outside of the data)
+	lead := make([]float32, fade*numChannels)
+	for i := 0; i < fade; i++ {
+		if from+i < 0 || from+i >= frames {
+			continue
+		}
+		copy(lead[i*numChannels:(i+1)*numChannels], w.data[(from+i)*numChannels:(from+i+1)*numChannels])
+	}
+
+	for _, seam := range seams {
+		to := w.frame(seam) - fade
+		for i := 0; i < fade; i++ {
+			if to+i < 0 || to+i >= frames {
+				continue
+			}
+			x := (float64(i) + 0.5) / float64(fade) * math.Pi / 2
+			out, in := float32(math.Cos(x)), float32(math.Sin(x))
+			for c := 0; c < numChannels; c++ {
+				j := (to+i)*numChannels + c
+				w.data[j] = w.data[j]*out + lead[i*numChannels+c]*in
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCrossfade(t *testing.T) {
+	const (
+		period = 37
+		// a loop from frame 100 repeating at frame 200
+		start = 100
+		seam  = 200
+	)
+	// s is the loop which continues from the frames before start
+	// but not into the repetition at seam
+	s := func(i int) float32 {
+		return float32(math.Sin(2 * math.Pi * float64(i) / period))
+	}
+	// twice the largest step of s allows for the rest of the faded out data
+	maxStep := float32(2 * 2 * math.Pi / period)
+
+	tests := []struct {
+		name  string
+		fade  float64
+		click bool
+	}{
+		{"no crossfade", 0, true},
+		{"10 ms", 0.01, false},
+		{"20 ms", 0.02, false},
+		{"longer than the loop", 0.15, false},
+	}
+
+	for _, tt := range tests {
+		w, err := newWAV(wavFormatPCM, 1, 1000, 16, true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := make([]float32, 300)
+		for i := range data {
+			if i < seam {
+				data[i] = s(i - start)
+			} else {
+				data[i] = s(i - seam)
+			}
+		}
+		w.data = append([]float32(nil), data...)
+		w.length = len(data)
+
+		w.crossfade(float64(start)/1000, []float64{float64(seam) / 1000}, tt.fade)
+
+		step := w.data[seam] - w.data[seam-1]
+		if click := step > maxStep || -step > maxStep; click != tt.click {
+			t.Errorf("%s: step of %v at the seam, want click %v", tt.name, step, tt.click)
+		}
+
+		fade := w.frame(tt.fade)
+		for i := range data {
+			if i >= seam-fade && i < seam {
+				x := (float64(i-seam+fade) + 0.5) / float64(fade) * math.Pi / 2
+				lead := float32(0)
+				if j := start - seam + i; j >= 0 {
+					lead = data[j]
+				}
+				want := data[i]*float32(math.Cos(x)) + lead*float32(math.Sin(x))
+				if math.Abs(float64(w.data[i]-want)) > 1e-6 {
+					t.Errorf("%s: frame %d = %v, want %v", tt.name, i, w.data[i], want)
+				}
+			} else if w.data[i] != data[i] {
+				t.Errorf("%s: frame %d outside of the crossfade changed from %v to %v", tt.name, i, data[i], w.data[i])
+			}
+		}
+	}
+}
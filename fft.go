@@ -0,0 +1,125 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// nextPowerOfTwo returns the smallest power of two not less than n
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// fft transforms x in place by the iterative radix-2 algorithm
+// (or the inverse transform if inverse is set)
+// length of x must be a power of two
+func fft(x []complex128, inverse bool) {
+	n := len(x)
+
+	// bit reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j |= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Rect(1, sign*2*math.Pi/float64(size))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], w*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+
+	if inverse {
+		for i := range x {
+			x[i] /= complex(float64(n), 0)
+		}
+	}
+}
+
+// directConvolutionLength is the longest impulse response convolved directly
+const directConvolutionLength = 64
+
+// convolve returns the full convolution of x with h
+// by overlap-add of FFT blocks (or directly for short h)
+func convolve(x, h []float32) []float32 {
+	if len(x) == 0 || len(h) == 0 {
+		return make([]float32, 0)
+	}
+	y := make([]float32, len(x)+len(h)-1)
+
+	if len(h) <= directConvolutionLength {
+		for i, xi := range x {
+			for j, hj := range h {
+				y[i+j] += xi * hj
+			}
+		}
+		return y
+	}
+
+	var (
+		n     = nextPowerOfTwo(2 * len(h))
+		block = n - len(h) + 1
+		H     = make([]complex128, n)
+		X     = make([]complex128, n)
+	)
+
+	for i, hi := range h {
+		H[i] = complex(float64(hi), 0)
+	}
+	fft(H, false)
+
+	for start := 0; start < len(x); start += block {
+		for i := range X {
+			X[i] = 0
+			if i < block && start+i < len(x) {
+				X[i] = complex(float64(x[start+i]), 0)
+			}
+		}
+
+		fft(X, false)
+		for i := range X {
+			X[i] *= H[i]
+		}
+		fft(X, true)
+
+		for i := 0; i < n && start+i < len(y); i++ {
+			y[start+i] += float32(real(X[i]))
+		}
+	}
+
+	return y
+}
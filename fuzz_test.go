@@ -0,0 +1,59 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package synth
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzMIDIToWAV(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte("MThd"))
+	f.Add(smf(0, 480, track(noteOn(0, 60, 100), noteOff(480, 60))))
+	f.Add(smf(1, 96,
+		track(tempo(0, 400000), event(0, 0xff, 0x58, 0x04, 0x03, 0x02, 0x18, 0x08), tempo(192, 600000)),
+		track(noteOn(0, 60, 100), event(48, 64, 90), event(48, 60, 0), noteOff(0, 64)),
+	))
+	f.Add(smf(0, 480, track(
+		event(0, 0xff, 0x01, 0x04, 't', 'e', 'x', 't'),
+		event(0, 0xf0, 0x02, 0x7e, 0xf7),
+		event(0, 0xb0, 0x07, 0x64),
+		event(0, 0xe0, 0x00, 0x50),
+		noteOn(0, 127, 1),
+		noteOff(1, 127),
+	)))
+	f.Add(append(chunk("RIFF", append([]byte("RMID"), chunk("data", smf(0, 480, track(noteOn(0, 60, 100), noteOff(480, 60))))...)), 0))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// errors are fine but panics are not
+		// (large renders are rejected to keep every input fast)
+		_, _ = MIDIToWAVWithOptions(bytes.NewReader(data), Options{
+			MaxOutputBytes: 1 << 20,
+		})
+		_, _ = MIDIToWAVWithOptions(bytes.NewReader(data), Options{
+			MaxOutputBytes: 1 << 20,
+			Metronome:      true,
+			Expression:     true,
+			PitchBend:      PitchBendLinear,
+			Quantize:       12,
+			Swing:          0.3,
+			Loops:          2,
+		})
+	})
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "math"
+
+// gate silences each channel where it stays below the threshold (normalized amplitude)
+// for hold seconds, closing over release seconds and opening over attack seconds
+// as soon as it reaches the threshold again
+func (w *wavData) gate(threshold float32, hold, attack, release float64) {
+	var (
+		numChannels = int(w.numChannels)
+		frames      = w.length / numChannels
+		holdFrames  = w.frame(hold)
+		// change of the gain per frame
+		opening = 1 / math.Max(float64(w.frame(attack)), 1)
+		closing = 1 / math.Max(float64(w.frame(release)), 1)
+	)
+
+	for c := 0; c < numChannels; c++ {
+		gain := 1.0
+		// frames since the channel went below the threshold
+		below := 0
+
+		for i := 0; i < frames; i++ {
+			j := i*numChannels + c
+			if math.Abs(float64(w.data[j])) >= float64(threshold) {
+				below = 0
+			} else {
+				below++
+			}
+
+			if below > holdFrames {
+				gain = math.Max(gain-closing, 0)
+			} else {
+				gain = math.Min(gain+opening, 1)
+			}
+			w.data[j] *= float32(gain)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGate(t *testing.T) {
+	// level is the amplitude of the frames of a gap between two tones
+	// of 200 frames each at 1000 frames per second
+	signal := func(gap int, level float32) []float32 {
+		data := make([]float32, 400+gap)
+		for i := range data {
+			amplitude := float32(0.5)
+			if i >= 200 && i < 200+gap {
+				amplitude = level
+			}
+			data[i] = amplitude * float32(1-2*(i%2))
+		}
+		return data
+	}
+
+	type span struct {
+		start, end int
+		// gain of the frames in the span (-1 for neither 0 nor 1)
+		gain float32
+	}
+	tests := []struct {
+		name  string
+		gap   int
+		level float32
+		spans []span
+	}{
+		{
+			name:  "gap gated to zero",
+			gap:   400,
+			level: 0.001,
+			// closing after 50 frames of hold over 20 frames of release
+			spans: []span{{0, 250, 1}, {250, 269, -1}, {269, 600, 0}, {600, 800, 1}},
+		},
+		{
+			name:  "silent gap",
+			gap:   400,
+			level: 0,
+			spans: []span{{0, 250, 1}, {600, 800, 1}},
+		},
+		{
+			name:  "gap shorter than hold",
+			gap:   40,
+			level: 0.001,
+			spans: []span{{0, 440, 1}},
+		},
+		{
+			name:  "gap above the threshold",
+			gap:   400,
+			level: 0.05,
+			spans: []span{{0, 800, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		w, err := newWAV(wavFormatPCM, 1, 1000, 16, true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := signal(tt.gap, tt.level)
+		w.data = append([]float32(nil), data...)
+		w.length = len(data)
+
+		w.gate(0.01, 0.05, 0.001, 0.02)
+
+		for _, s := range tt.spans {
+			for i := s.start; i < s.end; i++ {
+				if data[i] == 0 {
+					continue
+				}
+				gain := w.data[i] / data[i]
+				switch {
+				case s.gain == -1 && (gain <= 0 || gain >= 1):
+					t.Errorf("%s: frame %d has gain %v, want between 0 and 1", tt.name, i, gain)
+				case s.gain != -1 && math.Abs(float64(gain-s.gain)) > 1e-6:
+					t.Errorf("%s: frame %d has gain %v, want %v", tt.name, i, gain, s.gain)
+				}
+			}
+		}
+	}
+}
+
+func TestGateOptions(t *testing.T) {
+	tests := []struct {
+		opts                  Options
+		threshold             float64
+		hold, attack, release float64
+	}{
+		{Options{GateThreshold: -60}, 0.001, 0.05, 0.001, 0.02},
+		{Options{GateThreshold: -20, GateHold: 100, GateAttack: 5, GateRelease: 200}, 0.1, 0.1, 0.005, 0.2},
+	}
+
+	for _, tt := range tests {
+		threshold, hold, attack, release := tt.opts.gate()
+		if math.Abs(float64(threshold)-tt.threshold) > 1e-6 || hold != tt.hold || attack != tt.attack || release != tt.release {
+			t.Errorf("gate() of %+v = %v, %v, %v, %v, want %v, %v, %v, %v",
+				tt.opts, threshold, hold, attack, release, tt.threshold, tt.hold, tt.attack, tt.release)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "math"
+
+// humanize delays each note by a random time of at most maxDelay seconds
+// derived from the seed, the note, its channel and its start
+// so that the same input always renders the same output
+// (and a note is delayed by the same time in every stem)
+func humanize(notes []*progression, maxDelay float64, seed uint32) {
+	for _, note := range notes {
+		semitone, _ := semitoneFromNote(note.note)
+		micros := int(math.Round(note.offset * 1e6))
+		h := hitSeed(hitSeed(seed, semitone, micros), note.channel, 0)
+
+		note.offset += float64(h) / (1 << 32) * maxDelay
+	}
+}
+
+// humanizeVelocity changes velocity by a random amount of at most maxChange
+// derived from the seed, the note, its channel and its start tick
+// in the same way as humanize (within 1 to 127)
+func humanizeVelocity(velocity int, maxChange int, seed uint32, semitone int, channel int, tick int) int {
+	// another value than humanize so that the changes do not follow the delays
+	h := hitSeed(hitSeed(seed, semitone, tick), channel, 1)
+	change := int(uint64(h)*uint64(2*maxChange+1)>>32) - maxChange
+
+	return minInt(maxInt(velocity+change, 1), 127)
+}
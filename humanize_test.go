@@ -0,0 +1,156 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// grid returns a MIDI of 48 notes of different pitches every 96 ticks (0.1 seconds)
+// at the velocity
+func grid(velocity byte) []byte {
+	var events [][]byte
+	for i := 0; i < 48; i++ {
+		events = append(events, noteOn(0, byte(36+i), velocity), noteOff(96, byte(36+i)))
+	}
+	return smf(0, 480, track(events...))
+}
+
+func TestHumanizeTiming(t *testing.T) {
+	data := grid(100)
+
+	// delays returns the delay of each note humanized with the seed
+	delays := func(maxDelay float64, seed uint32) []float64 {
+		prog := collect(t, data, Options{})
+		offsets := make([]float64, len(prog))
+		for i, p := range prog {
+			offsets[i] = p.offset
+		}
+		humanize(prog, maxDelay, seed)
+
+		d := make([]float64, len(prog))
+		for i, p := range prog {
+			d[i] = p.offset - offsets[i]
+		}
+		return d
+	}
+
+	tests := []struct {
+		name     string
+		maxDelay float64
+		seed     uint32
+	}{
+		{"off", 0, 0},
+		{"10 ms", 0.01, 0},
+		{"30 ms", 0.03, 0},
+		{"seeded", 0.01, 7},
+	}
+
+	outputs := make(map[string][]float64)
+	for _, tt := range tests {
+		d := delays(tt.maxDelay, tt.seed)
+		var min, max float64
+		for i, delay := range d {
+			if delay < 0 || delay > tt.maxDelay {
+				t.Errorf("%s: note %d delayed by %v, want 0 to %v", tt.name, i, delay, tt.maxDelay)
+			}
+			if i == 0 || delay < min {
+				min = delay
+			}
+			if i == 0 || delay > max {
+				max = delay
+			}
+		}
+		// the delays spread over the range
+		if max-min < tt.maxDelay/2 {
+			t.Errorf("%s: delays from %v to %v, want a spread over %v", tt.name, min, max, tt.maxDelay)
+		}
+
+		again := delays(tt.maxDelay, tt.seed)
+		for i := range d {
+			if d[i] != again[i] {
+				t.Errorf("%s: note %d delayed by %v and %v", tt.name, i, d[i], again[i])
+			}
+		}
+		outputs[tt.name] = d
+	}
+
+	same := 0
+	for i := range outputs["10 ms"] {
+		if outputs["10 ms"][i] == outputs["seeded"][i] {
+			same++
+		}
+	}
+	if same == len(outputs["seeded"]) {
+		t.Errorf("HumanizeSeed 7 delays the notes as the default seed")
+	}
+}
+
+func TestHumanizeVelocity(t *testing.T) {
+	tests := []struct {
+		name     string
+		velocity byte
+		opts     Options
+		min, max int
+		clamped  bool
+	}{
+		{"off", 100, Options{}, 100, 100, false},
+		{"up to 10", 100, Options{HumanizeVelocity: 10}, 90, 110, false},
+		{"seeded", 100, Options{HumanizeVelocity: 10, HumanizeSeed: 7}, 90, 110, false},
+		{"clamped to 1", 5, Options{HumanizeVelocity: 20}, 1, 25, true},
+		{"clamped to 127", 120, Options{HumanizeVelocity: 20}, 100, 127, true},
+	}
+
+	outputs := make(map[string][]int)
+	for _, tt := range tests {
+		data := grid(tt.velocity)
+		velocities := func() []int {
+			var v []int
+			for _, p := range collect(t, data, tt.opts) {
+				v = append(v, int(math.Round(float64(p.amplitude)*128)))
+			}
+			return v
+		}
+		v := velocities()
+
+		clamped := false
+		low, high := 127, 1
+		for i, velocity := range v {
+			if velocity < tt.min || velocity > tt.max {
+				t.Errorf("%s: note %d at velocity %d, want %d to %d", tt.name, i, velocity, tt.min, tt.max)
+			}
+			clamped = clamped || velocity == 1 || velocity == 127
+			low, high = minInt(low, velocity), maxInt(high, velocity)
+		}
+		if clamped != tt.clamped {
+			t.Errorf("%s: clamped %v, want %v", tt.name, clamped, tt.clamped)
+		}
+		// the changes spread over the range
+		if change := tt.opts.HumanizeVelocity; high-low < change {
+			t.Errorf("%s: velocities from %d to %d, want a spread over %d", tt.name, low, high, change)
+		}
+
+		if again := velocities(); fmt.Sprint(again) != fmt.Sprint(v) {
+			t.Errorf("%s: velocities %v and %v", tt.name, v, again)
+		}
+		outputs[tt.name] = v
+	}
+
+	if fmt.Sprint(outputs["up to 10"]) == fmt.Sprint(outputs["seeded"]) {
+		t.Errorf("HumanizeSeed 7 changes the velocities as the default seed")
+	}
+}
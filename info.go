@@ -0,0 +1,42 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "encoding/binary"
+
+// infoField is a text field of a LIST chunk of type INFO (e.g. "ICOP" for copyright)
+type infoField struct {
+	id   string
+	text string
+}
+
+// infoList encodes the fields into the data of a LIST chunk of type INFO
+func infoList(fields ...infoField) []byte {
+	data := []byte("INFO")
+	for _, field := range fields {
+		// text is terminated by NUL and aligned to even bytes
+		text := append([]byte(field.text), 0x00)
+		size := len(text)
+		if len(text)%2 == 1 {
+			text = append(text, 0x00)
+		}
+
+		header := make([]byte, 8)
+		copy(header, field.id)
+		binary.LittleEndian.PutUint32(header[4:8], uint32(size))
+		data = append(append(data, header...), text...)
+	}
+	return data
+}
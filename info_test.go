@@ -0,0 +1,87 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestCopyrightInfo(t *testing.T) {
+	// copyright encodes a copyrightNotice meta event
+	copyright := func(text string) []byte {
+		return event(0, append([]byte{0xff, 0x02, byte(len(text))}, text...)...)
+	}
+	notes := [][]byte{noteOn(0, 69, 100), noteOff(480, 69)}
+
+	tests := []struct {
+		name string
+		data []byte
+		opts Options
+		// ICOP text or empty if there is no LIST chunk
+		want string
+	}{
+		{
+			name: "odd length",
+			data: smf(0, 480, track(append([][]byte{copyright("(C) 2020 entooone")}, notes...)...)),
+			want: "(C) 2020 entooone",
+		},
+		{
+			name: "even length",
+			data: smf(0, 480, track(append([][]byte{copyright("(C) entooone")}, notes...)...)),
+			want: "(C) entooone",
+		},
+		{
+			name: "disabled",
+			data: smf(0, 480, track(append([][]byte{copyright("(C) entooone")}, notes...)...)),
+			opts: Options{DisableCopyright: true},
+		},
+		{
+			name: "no copyrightNotice",
+			data: smf(0, 480, track(notes...)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := MIDIToWAVWithOptions(bytes.NewReader(tt.data), tt.opts)
+			if err != nil {
+				t.Fatalf("MIDIToWAVWithOptions() error = %v", err)
+			}
+			list, ok := riffChunks(t, buf.Bytes())["LIST"]
+			if tt.want == "" {
+				if ok {
+					t.Errorf("LIST chunk % x, want none", list)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("no LIST chunk")
+			}
+
+			if len(list) < 12 || string(list[0:4]) != "INFO" || string(list[4:8]) != "ICOP" {
+				t.Fatalf("LIST chunk % x, want INFO with ICOP", list)
+			}
+			size := int(binary.LittleEndian.Uint32(list[8:12]))
+			if size != len(tt.want)+1 || len(list) != 12+size+size%2 {
+				t.Fatalf("ICOP of %d bytes in LIST of %d bytes, want %d bytes with NUL", size, len(list), len(tt.want)+1)
+			}
+			if got := string(list[12 : 12+size]); got != tt.want+"\x00" {
+				t.Errorf("ICOP = %q, want %q", got, tt.want+"\x00")
+			}
+		})
+	}
+}
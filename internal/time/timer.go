@@ -15,17 +15,21 @@
 package time
 
 type criticalPoint struct {
-	delta               int
+	// absolute time in ticks where the tempo changes
+	tick                int
 	microsecondsPerBeat int
 }
 
-// Timer calculate time from delta ticks when MIDI file has several "setTempo" events
+// Timer calculate time from absolute ticks when MIDI file has several "setTempo" events
 type Timer struct {
 	ticksPerBeat   int
 	criticalPoints []criticalPoint
+	// ticksPerSecond is the fixed rate of SMPTE ticks
+	// which are not affected by the tempo (zero unless SMPTE)
+	ticksPerSecond float64
 }
 
-// NewTimer has delta to represent ticks since last time change
+// NewTimer has critical points at absolute ticks in order of time
 func NewTimer(ticksPerBeat int) *Timer {
 	return &Timer{
 		ticksPerBeat:   ticksPerBeat,
@@ -33,44 +37,61 @@ func NewTimer(ticksPerBeat int) *Timer {
 	}
 }
 
+// NewSMPTETimer has ticks which subdivide SMPTE frames
+// at the frame rate (e.g. 30000/1001 for 29.97 fps)
+// so that the time does not depend on critical points
+func NewSMPTETimer(framesPerSecond float64, ticksPerFrame int) *Timer {
+	return &Timer{
+		criticalPoints: make([]criticalPoint, 0),
+		ticksPerSecond: framesPerSecond * float64(ticksPerFrame),
+	}
+}
+
 const (
 	microsecondsPerSecond = 1000000
 
-	// midi standard initializes file with this value
-	microsecondsPerBeatDefault = 500000
+	// MicrosecondsPerBeatDefault is the tempo (120 BPM) until the first
+	// "setTempo" event as the midi standard initializes file with this value
+	MicrosecondsPerBeatDefault = 500000
 )
 
-// AddCriticalPoint add criticalPoint to timer
-func (t *Timer) AddCriticalPoint(delta, microsecondsPerBeat int) {
+// AddCriticalPoint add criticalPoint at absolute tick to timer
+func (t *Timer) AddCriticalPoint(tick, microsecondsPerBeat int) {
 	t.criticalPoints = append(t.criticalPoints, criticalPoint{
-		delta:               delta,
+		tick:                tick,
 		microsecondsPerBeat: microsecondsPerBeat,
 	})
 }
 
-// Time gets time from timer
-func (t *Timer) Time(delta int) float32 {
-	var time float32
-	microsecondsPerBeat := microsecondsPerBeatDefault
-	var cp criticalPoint
+// seconds converts ticks into seconds at the tempo
+func (t *Timer) seconds(ticks, microsecondsPerBeat int) float64 {
+	return float64(ticks) * float64(microsecondsPerBeat) / float64(t.ticksPerBeat) / microsecondsPerSecond
+}
+
+// Time gets time in seconds at absolute tick from timer
+func (t *Timer) Time(tick int) float64 {
+	if t.ticksPerSecond > 0 {
+		return float64(tick) / t.ticksPerSecond
+	}
 
-	// iterate through time changes while decrementing delta ticks to 0
-	for i := 0; i < len(t.criticalPoints) && delta > 0; i++ {
-		cp = t.criticalPoints[i]
+	var (
+		time                float64
+		lastTick            int
+		microsecondsPerBeat = MicrosecondsPerBeatDefault
+	)
 
-		// incrementally calculate the time passed for each range of timing
-		if delta >= cp.delta {
-			time += float32(cp.delta*microsecondsPerBeat) / float32(t.ticksPerBeat) / microsecondsPerSecond
-			delta -= cp.delta
-		} else {
-			time += float32(delta*microsecondsPerBeat) / float32(t.ticksPerBeat) / microsecondsPerSecond
-			delta = 0
+	// incrementally calculate the time passed for each range of timing
+	for _, cp := range t.criticalPoints {
+		if cp.tick >= tick {
+			break
 		}
 
+		time += t.seconds(cp.tick-lastTick, microsecondsPerBeat)
+		lastTick = cp.tick
 		microsecondsPerBeat = cp.microsecondsPerBeat
 	}
 
-	time += float32(delta*microsecondsPerBeat) / float32(t.ticksPerBeat) / microsecondsPerSecond
+	time += t.seconds(tick-lastTick, microsecondsPerBeat)
 
 	return time
 }
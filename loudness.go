@@ -0,0 +1,52 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "math"
+
+// maxLoudnessGain limits the boost of equal-loudness compensation (about 12 dB)
+const maxLoudnessGain = 4
+
+// aWeighting returns the linear A-weighting response at frequency in Hz
+func aWeighting(frequency float64) float64 {
+	f2 := frequency * frequency
+	return 12194 * 12194 * f2 * f2 /
+		((f2 + 20.6*20.6) * math.Sqrt((f2+107.7*107.7)*(f2+737.9*737.9)) * (f2 + 12194*12194))
+}
+
+// loudnessGain returns the gain making a tone of frequency in Hz
+// as loud as a tone of 1 kHz by the inverse of A-weighting
+func loudnessGain(frequency float32) float32 {
+	if frequency <= 0 {
+		return 1
+	}
+	gain := aWeighting(1000) / aWeighting(float64(frequency))
+	return float32(math.Min(gain, maxLoudnessGain))
+}
+
+// loudnessWeight returns the velocity of note at semitone counted for normalizing volume
+// which includes the boost of EqualLoudness so that compensated notes do not clip
+func loudnessWeight(semitone int, note *noteValue, opts Options) int {
+	channel := int(note.channel)
+	if !opts.EqualLoudness || (opts.PercussionNoise && channel == percussionChannel) {
+		return note.velocity
+	}
+	pitch, ok := transpose(semitone, opts.Transpose+opts.ChannelTranspose[channel], opts.TransposePolicy)
+	if !ok {
+		return note.velocity
+	}
+	frequency := detune(frequencyFromSemitone(pitch), opts.Detune[channel]+opts.PitchShiftCents)
+	return int(math.Ceil(float64(float32(note.velocity) * loudnessGain(frequency))))
+}
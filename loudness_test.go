@@ -0,0 +1,66 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestEqualLoudnessNoClip(t *testing.T) {
+	tests := []struct {
+		name  string
+		notes []byte
+	}{
+		{"low note", []byte{24}},
+		{"high note", []byte{120}},
+		{"middle note", []byte{72}},
+		{"low chord", []byte{24, 28, 31, 36}},
+		{"wide chord", []byte{21, 60, 108, 127}},
+	}
+
+	for _, tt := range tests {
+		var events [][]byte
+		for _, n := range tt.notes {
+			events = append(events, noteOn(0, n, 127))
+		}
+		for i, n := range tt.notes {
+			delta := uint(0)
+			if i == 0 {
+				delta = 960
+			}
+			events = append(events, noteOff(delta, n))
+		}
+		data := smf(0, 480, track(events...))
+
+		for _, loudness := range []bool{false, true} {
+			samples, _, err := MIDIToFloat32(bytes.NewReader(data), Options{EqualLoudness: loudness})
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			var peak float64
+			for _, s := range samples {
+				peak = math.Max(peak, math.Abs(float64(s)))
+			}
+			if peak > 1 {
+				t.Errorf("%s (EqualLoudness %v): peak %v, want <= 1", tt.name, loudness, peak)
+			}
+			if peak < 0.1 {
+				t.Errorf("%s (EqualLoudness %v): peak %v, want audible output", tt.name, loudness, peak)
+			}
+		}
+	}
+}
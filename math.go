@@ -27,3 +27,14 @@ func maxInt(x, y int) int {
 	}
 	return y
 }
+
+// clampSample limits normalized sample to [-1, 1]
+func clampSample(d float32) float32 {
+	if d > 1 {
+		return 1
+	}
+	if d < -1 {
+		return -1
+	}
+	return d
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "github.com/entooone/simple-midi-synth/internal/time"
+
+const (
+	// length of a single click in seconds
+	clickTime = 0.03
+
+	defaultMetronomeVolume = 0.5
+
+	// metronomeChannel is the channel of the clicks
+	// which do not belong to any MIDI channel
+	metronomeChannel = -1
+)
+
+// metronomeClicks generates a click at each beat up to endTick
+// with the first beat of each bar accented
+func metronomeClicks(timeSignatures []TimeSig, ticksPerBeat int, endTick int, timer *time.Timer, volume float32) []*progression {
+	// midi standard assumes 4/4 until the first time signature
+	sigs := append([]TimeSig{{Numerator: 4, Denominator: 4}}, timeSignatures...)
+	clicks := make([]*progression, 0)
+
+	for i, sig := range sigs {
+		end := endTick
+		if i+1 < len(sigs) {
+			end = minInt(sigs[i+1].Tick, endTick)
+		}
+
+		if sig.Denominator <= 0 || sig.Numerator <= 0 {
+			continue
+		}
+		beatTicks := ticksPerBeat * 4 / sig.Denominator
+		if beatTicks <= 0 {
+			continue
+		}
+
+		for tick, beat := sig.Tick, 0; tick < end; tick, beat = tick+beatTicks, beat+1 {
+			note, amplitude := "C6", volume*0.6
+			if beat%sig.Numerator == 0 {
+				note, amplitude = "C7", volume
+			}
+
+			clicks = append(clicks, &progression{
+				note:      note,
+				time:      clickTime,
+				amplitude: amplitude,
+				offset:    timer.Time(tick),
+				channel:   metronomeChannel,
+			})
+		}
+	}
+
+	return clicks
+}
+
+// splitClicks separates the clicks of metronomeClicks from the other notes
+// keeping the order of both
+func splitClicks(notes []*progression) ([]*progression, []*progression) {
+	var (
+		others = make([]*progression, 0, len(notes))
+		clicks []*progression
+	)
+	for _, note := range notes {
+		if note.channel == metronomeChannel {
+			clicks = append(clicks, note)
+		} else {
+			others = append(others, note)
+		}
+	}
+	return others, clicks
+}
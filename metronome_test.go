@@ -0,0 +1,138 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/entooone/simple-midi-synth/internal/time"
+)
+
+func TestMetronomeClicks(t *testing.T) {
+	tests := []struct {
+		name       string
+		signatures []TimeSig
+		endTick    int
+		clicks     int
+		accents    int
+	}{
+		{"default 4/4", nil, 8 * 480, 8, 2},
+		{"3/4", []TimeSig{{Numerator: 3, Denominator: 4}}, 6 * 480, 6, 2},
+		{"6/8", []TimeSig{{Numerator: 6, Denominator: 8}}, 6 * 480, 12, 2},
+		{"change to 2/4", []TimeSig{{Tick: 4 * 480, Numerator: 2, Denominator: 4}}, 8 * 480, 8, 3},
+		{"zero denominator", []TimeSig{{Numerator: 4, Denominator: 0}}, 8 * 480, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clicks := metronomeClicks(tt.signatures, 480, tt.endTick, time.NewTimer(480), 1)
+
+			accents := 0
+			for _, click := range clicks {
+				if click.note == "C7" {
+					accents++
+				}
+			}
+			if len(clicks) != tt.clicks || accents != tt.accents {
+				t.Errorf("got %d clicks with %d accents, want %d with %d", len(clicks), accents, tt.clicks, tt.accents)
+			}
+		})
+	}
+}
+
+func TestMetronomeHugeDenominator(t *testing.T) {
+	// the denominator 2^64 overflowed to zero and divided by zero
+	data := smf(0, 480, track(
+		event(0, 0xff, 0x58, 0x04, 0x03, 0x40, 0x18, 0x08),
+		noteOn(0, 60, 100),
+		noteOff(480, 60),
+	))
+
+	var warnings []error
+	_, err := MIDIToWAVWithOptions(bytes.NewReader(data), Options{
+		Metronome: true,
+		Warn:      func(err error) { warnings = append(warnings, err) },
+	})
+	if err != nil {
+		t.Fatalf("MIDIToWAVWithOptions() error = %v", err)
+	}
+	if len(warnings) != 1 || !errors.Is(warnings[0], ErrInvalidEvent) {
+		t.Errorf("warnings = %v, want a clamped denominator", warnings)
+	}
+}
+
+func TestMetronomeLevel(t *testing.T) {
+	// a quiet note on one channel and a loud chord on another for 2 seconds
+	data := smf(0, 480, track(
+		noteOn(0, 57, 20),
+		event(0, 0x91, 60, 127),
+		event(0, 0x91, 64, 127),
+		noteOff(1920, 57),
+		event(0, 0x81, 60, 0),
+		event(0, 0x81, 64, 0),
+	))
+
+	// clicks returns the peak of the clicks rendered with opts
+	// as the difference of the renders with and without them
+	clicks := func(opts Options) float64 {
+		opts.Waveform = WaveformSine
+		without, _, err := MIDIToFloat32(bytes.NewReader(data), opts)
+		if err != nil {
+			t.Fatalf("MIDIToFloat32() error = %v", err)
+		}
+		opts.Metronome = true
+		with, _, err := MIDIToFloat32(bytes.NewReader(data), opts)
+		if err != nil {
+			t.Fatalf("MIDIToFloat32() with Metronome error = %v", err)
+		}
+
+		var peak float64
+		for i, s := range with {
+			if i < len(without) {
+				s -= without[i]
+			}
+			peak = math.Max(peak, math.Abs(float64(s)))
+		}
+		return peak
+	}
+
+	want := clicks(Options{})
+	if math.Abs(want-defaultMetronomeVolume) > 0.01 {
+		t.Fatalf("peak of the clicks = %g, want %g", want, float64(defaultMetronomeVolume))
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"per channel", Options{NormalizePerChannel: true}},
+		{"auto gain", Options{AutoGain: true}},
+		{"both", Options{NormalizePerChannel: true, AutoGain: true}},
+		{"headroom", Options{Headroom: 6}},
+		{"gain", Options{Gain: 0.5}},
+		{"no normalization", Options{DisableNormalization: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clicks(tt.opts); math.Abs(got-want) > 1e-3 {
+				t.Errorf("peak of the clicks = %g, want %g", got, want)
+			}
+		})
+	}
+}
@@ -15,16 +15,29 @@
 package synth
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"sort"
 	"strconv"
+	"strings"
+
+	"github.com/entooone/simple-midi-synth/internal/time"
 )
 
 type midiStream struct {
 	data              []byte
 	byteOffset        int
 	lastEventTypeByte byte
+	// first error of reading, once set all reads return zero values
+	err error
+	// problems that did not stop reading
+	warnings []error
+	// decoders of meta events by sub type byte
+	metaHandlers map[byte]MetaHandler
 }
 
 func newMIDIStream(reader io.Reader) (*midiStream, error) {
@@ -40,7 +53,23 @@ func newMIDIStream(reader io.Reader) (*midiStream, error) {
 	}, nil
 }
 
+// has reports whether byteLength bytes remain in the stream
+// and sets the error of the stream otherwise
+func (m *midiStream) has(byteLength int) bool {
+	if m.err != nil {
+		return false
+	}
+	if byteLength < 0 || byteLength > len(m.data)-m.byteOffset {
+		m.err = fmt.Errorf("%w: %d bytes needed at offset %d", ErrTruncated, byteLength, m.byteOffset)
+		return false
+	}
+	return true
+}
+
 func (m *midiStream) readString(byteLength int) string {
+	if !m.has(byteLength) {
+		return ""
+	}
 	byteOffset := m.byteOffset
 
 	var str string
@@ -52,6 +81,9 @@ func (m *midiStream) readString(byteLength int) string {
 }
 
 func (m *midiStream) readUint32() uint32 {
+	if !m.has(4) {
+		return 0
+	}
 	byteOffset := m.byteOffset
 
 	value := (uint32(m.data[byteOffset]) << 24) |
@@ -65,6 +97,9 @@ func (m *midiStream) readUint32() uint32 {
 }
 
 func (m *midiStream) readUint24() uint32 {
+	if !m.has(3) {
+		return 0
+	}
 	byteOffset := m.byteOffset
 
 	value := (uint32(m.data[byteOffset]) << 16) |
@@ -77,6 +112,9 @@ func (m *midiStream) readUint24() uint32 {
 }
 
 func (m *midiStream) readUint16() uint16 {
+	if !m.has(2) {
+		return 0
+	}
 	byteOffset := m.byteOffset
 
 	value := (uint16(m.data[byteOffset]) << 8) |
@@ -88,6 +126,9 @@ func (m *midiStream) readUint16() uint16 {
 }
 
 func (m *midiStream) readUint8() uint8 {
+	if !m.has(1) {
+		return 0
+	}
 	byteOffset := m.byteOffset
 
 	value := m.data[byteOffset]
@@ -97,14 +138,23 @@ func (m *midiStream) readUint8() uint8 {
 	return value
 }
 
+// maxVarUintBytes is the length of the largest variable-length quantity (0x0FFFFFFF)
+const maxVarUintBytes = 4
+
 func (m *midiStream) readVarUint() uint {
 	var (
 		value uint
 		ui8   byte
 	)
+	offset := m.byteOffset
 	ui8 = m.readUint8()
 	value = (value << 7) + (uint(ui8) & 0x7f)
-	for (ui8 & 0x80) == 0x80 {
+	for n := 1; (ui8&0x80) == 0x80 && m.err == nil; n++ {
+		// longer quantities would overflow the lengths
+		if n == maxVarUintBytes {
+			m.err = fmt.Errorf("%w: variable-length quantity longer than %d bytes at offset %d", ErrInvalidEvent, maxVarUintBytes, offset)
+			return 0
+		}
 		ui8 = m.readUint8()
 		value = (value << 7) + (uint(ui8) & 0x7f)
 	}
@@ -113,40 +163,68 @@ func (m *midiStream) readVarUint() uint {
 }
 
 func (m *midiStream) skip(byteLength int) {
+	if !m.has(byteLength) {
+		return
+	}
 	m.byteOffset += byteLength
 }
 
+const (
+	// length of chunk id and chunk length
+	chunkHeaderLength = 8
+
+	// length of the whole MThd chunk
+	headerChunkLength = chunkHeaderLength + 6
+)
+
 type midiChunk struct {
 	id     string
 	length int
 	data   []byte
 }
 
-func (m *midiStream) readChunk() *midiChunk {
+func (m *midiStream) readChunk() (*midiChunk, error) {
 	id := m.readString(4)
-	length := int(m.readUint32())
+	size := m.readUint32()
+
+	// compare before converting to int which overflows on 32-bit platforms
+	if remaining := len(m.data) - m.byteOffset; m.err == nil && uint64(size) > uint64(remaining) {
+		m.err = fmt.Errorf("%w: %q chunk of length %d exceeds the remaining %d bytes", ErrTruncated, id, size, remaining)
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	length := int(size)
 	byteOffset := m.byteOffset
 
-	m.byteOffset += length
+	m.skip(length)
+	if m.err != nil {
+		return nil, m.err
+	}
 
-	data := m.data[byteOffset:m.byteOffset]
+	// limit the capacity so that the data of the chunk cannot extend
+	// into the following chunks
+	data := m.data[byteOffset:m.byteOffset:m.byteOffset]
 
 	return &midiChunk{
 		id:     id,
 		length: length,
 		data:   data,
-	}
+	}, nil
 }
 
 type midiEvent struct {
-	delta     uint
+	delta uint
+	// tick is the absolute time in ticks from the start of the track
+	tick      int
 	eventType string
 	subType   string
 	value     map[string]string
 	channel   byte
 }
 
-func (m *midiStream) readEvent() *midiEvent {
+func (m *midiStream) readEvent() (*midiEvent, error) {
 	delta := m.readVarUint()
 	eventTypeByte := m.readUint8()
 	var (
@@ -164,6 +242,7 @@ func (m *midiStream) readEvent() *midiEvent {
 
 			subTypeByte := m.readUint8()
 			length := int(m.readVarUint())
+			start := m.byteOffset
 
 			switch subTypeByte {
 			case 0x00:
@@ -203,7 +282,9 @@ func (m *midiStream) readEvent() *midiEvent {
 				}
 			case 0x2f:
 				subType = "endOfTrack"
+				// a preceding length was likely misread
 				if length > 0 {
+					m.warnings = append(m.warnings, fmt.Errorf("%w: endOfTrack with length %d at offset %d", ErrInvalidEvent, length, m.byteOffset))
 					m.skip(length)
 				}
 			case 0x51:
@@ -239,7 +320,7 @@ func (m *midiStream) readEvent() *midiEvent {
 			case 0x59:
 				subType = "keySignature"
 				if length == 2 {
-					value["key"] = fmt.Sprintf("%d", m.readUint8())
+					value["key"] = fmt.Sprintf("%d", int8(m.readUint8()))
 					value["scale"] = fmt.Sprintf("%d", m.readUint8())
 				} else {
 					m.skip(length)
@@ -251,6 +332,13 @@ func (m *midiStream) readEvent() *midiEvent {
 				subType = "unknown"
 				value["value"] = m.readString(length)
 			}
+
+			// custom handlers add to the decoded value
+			if handler, ok := m.metaHandlers[subTypeByte]; ok && m.err == nil {
+				for k, v := range handler(m.data[start : start+length]) {
+					value[k] = v
+				}
+			}
 		// sysex event
 		case 0xf0:
 			eventType = "sysEx"
@@ -265,6 +353,9 @@ func (m *midiStream) readEvent() *midiEvent {
 			length := int(m.readVarUint())
 			value["value"] = m.readString(length)
 		}
+
+		// sysex and meta events cancel any running status
+		m.lastEventTypeByte = 0x00
 		// channel event
 	} else {
 		var param byte
@@ -272,6 +363,11 @@ func (m *midiStream) readEvent() *midiEvent {
 		// if the high bit  is low
 		// use running event type mode
 		if (eventTypeByte & 0x80) == 0x00 {
+			// the status was cancelled by a meta or sysex event
+			// (or there was none) so the event cannot be decoded
+			if m.lastEventTypeByte == 0x00 && m.err == nil {
+				m.err = fmt.Errorf("%w: running status without a channel event at offset %d", ErrInvalidEvent, m.byteOffset-1)
+			}
 			param = eventTypeByte
 			eventTypeByte = m.lastEventTypeByte
 		} else {
@@ -322,11 +418,502 @@ func (m *midiStream) readEvent() *midiEvent {
 			value["value"] = fmt.Sprintf("%d", (uint(param)<<8)+uint(m.readUint8()))
 		}
 	}
+	if m.err != nil {
+		return nil, m.err
+	}
+
 	return &midiEvent{
 		delta:     delta,
 		eventType: eventType,
 		subType:   subType,
 		value:     value,
 		channel:   channel,
+	}, nil
+}
+
+// readTrack decodes the events in the data of a MTrk chunk
+// and returns them with the problems that did not stop decoding
+// An event continuing past the end of the chunk is ErrTruncated
+// even if the following bytes of the file would complete it.
+func readTrack(data []byte, metaHandlers map[byte]MetaHandler) ([]*midiEvent, []error, error) {
+	trackStream, err := newMIDIStream(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	trackStream.metaHandlers = metaHandlers
+	track := make([]*midiEvent, 0)
+
+	tick := 0
+	for trackStream.byteOffset < len(data) {
+		event, err := trackStream.readEvent()
+		if err != nil {
+			return nil, nil, err
+		}
+		tick += int(event.delta)
+		event.tick = tick
+		track = append(track, event)
+	}
+
+	return track, trackStream.warnings, nil
+}
+
+type midiFile struct {
+	format       int
+	timeDivision int
+	tracks       [][]*midiEvent
+	// problems that did not stop parsing
+	warnings []error
+	// chunks other than MThd and MTrk in order of the file
+	chunks []*midiChunk
+}
+
+// unwrapRMID returns the standard MIDI file embedded in the data chunk
+// of a RIFF MIDI (RMID) file or data as is if it is not wrapped
+func unwrapRMID(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "RMID" {
+		return data, nil
+	}
+
+	// RIFF chunks have little endian sizes and are aligned to even bytes
+	for offset := 12; offset+chunkHeaderLength <= len(data); {
+		id := string(data[offset : offset+4])
+		length := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		offset += chunkHeaderLength
+
+		if length < 0 || length > len(data)-offset {
+			return nil, fmt.Errorf("%w: RMID chunk %q of length %d", ErrTruncated, id, length)
+		}
+		if id == "data" {
+			return data[offset : offset+length], nil
+		}
+
+		offset += length + length%2
+	}
+
+	return nil, fmt.Errorf("%w: RMID without data chunk", ErrInvalidHeader)
+}
+
+// parseMIDI reads the header and every track of a standard MIDI file
+// (or of a RIFF MIDI file)
+func parseMIDI(reader io.Reader) (*midiFile, error) {
+	return parseMIDIWithHandlers(reader, nil, 0)
+}
+
+// parseMIDIWithHandlers reads MIDI in the same way as parseMIDI
+// decoding meta events with metaHandlers in addition
+// and rejecting files which declare more than maxTracks tracks (unlimited if zero)
+func parseMIDIWithHandlers(reader io.Reader, metaHandlers map[byte]MetaHandler, maxTracks int) (*midiFile, error) {
+	midiStream, err := newMIDIStream(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	midiStream.data, err = unwrapRMID(midiStream.data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(midiStream.data) < headerChunkLength {
+		return nil, fmt.Errorf("%w: %d bytes is shorter than the header", ErrTruncated, len(midiStream.data))
+	}
+
+	header, err := midiStream.readChunk()
+	if err != nil {
+		return nil, err
+	}
+
+	if header.id != "MThd" || header.length != 6 {
+		return nil, fmt.Errorf("%w: chunk %q of length %d", ErrInvalidHeader, header.id, header.length)
+	}
+
+	headerStream, err := newMIDIStream(bytes.NewReader(header.data))
+	if err != nil {
+		return nil, err
+	}
+	format := int(headerStream.readUint16())
+	trackCount := int(headerStream.readUint16())
+	timeDivision := int(headerStream.readUint16())
+
+	if timeDivision == 0 {
+		return nil, fmt.Errorf("%w: time division is zero", ErrInvalidHeader)
+	}
+	if maxTracks > 0 && trackCount > maxTracks {
+		return nil, fmt.Errorf("%w: %d tracks exceed %d tracks", ErrTooLarge, trackCount, maxTracks)
+	}
+	tracks := make([][]*midiEvent, 0)
+	warnings := make([]error, 0)
+	chunks := make([]*midiChunk, 0)
+
+	// read until trackCount tracks are found or the stream is exhausted
+	trackChunks := 0
+	for trackChunks < trackCount && len(midiStream.data)-midiStream.byteOffset >= chunkHeaderLength {
+		offset := midiStream.byteOffset
+		id := midiStream.data[offset : offset+4]
+
+		// a wrong length of the previous chunk leaves the stream
+		// in the middle of data so resume at the next track
+		if !isChunkID(id) {
+			next := bytes.Index(midiStream.data[offset+1:], []byte("MTrk"))
+			if next < 0 {
+				warnings = append(warnings, fmt.Errorf("%w: no chunk at offset %d", ErrInvalidHeader, offset))
+				break
+			}
+			warnings = append(warnings, fmt.Errorf("%w: skipped %d bytes without a chunk at offset %d", ErrInvalidHeader, next+1, offset))
+			midiStream.byteOffset += next + 1
+			continue
+		}
+
+		trackChunk, err := midiStream.readChunk()
+		if err != nil {
+			// the tracks read so far are kept if another chunk is cut off
+			if string(id) != "MTrk" {
+				warnings = append(warnings, fmt.Errorf("%q chunk at offset %d: %w", id, offset, err))
+				break
+			}
+			return nil, err
+		}
+
+		// other chunks (e.g. "XFIH" of Yamaha XF) are kept for ExtraChunks
+		if trackChunk.id != "MTrk" {
+			chunks = append(chunks, trackChunk)
+			continue
+		}
+		trackChunks++
+
+		track, trackWarnings, err := readTrack(trackChunk.data, metaHandlers)
+		if err != nil {
+			return nil, fmt.Errorf("track %d: %w", len(tracks), err)
+		}
+		if len(track) == 0 {
+			warnings = append(warnings, fmt.Errorf("%w: track %d has no events", ErrTruncated, len(tracks)))
+		}
+		tracks = append(tracks, track)
+		warnings = append(warnings, trackWarnings...)
+	}
+
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("%w: no tracks", ErrTruncated)
+	}
+
+	if trackChunks < trackCount {
+		warnings = append(warnings, fmt.Errorf("%w: header declares %d tracks but found %d", ErrTruncated, trackCount, trackChunks))
+	} else if midiStream.byteOffset < len(midiStream.data) {
+		warnings = append(warnings, fmt.Errorf("%w: ignored %d bytes after the last track", ErrInvalidHeader, len(midiStream.data)-midiStream.byteOffset))
+	}
+
+	return &midiFile{
+		format:       format,
+		timeDivision: timeDivision,
+		tracks:       tracks,
+		warnings:     warnings,
+		chunks:       chunks,
+	}, nil
+}
+
+// isChunkID reports whether id is made of 4 printable ASCII characters
+func isChunkID(id []byte) bool {
+	for _, c := range id {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return len(id) == 4
+}
+
+// sequenceNumber returns the number given by the sequenceNumber event
+// at the beginning of track or the location of the track by default
+func (f *midiFile) sequenceNumber(track int) int {
+	for _, event := range f.tracks[track] {
+		if event.delta > 0 {
+			break
+		}
+		if event.subType == "sequenceNumber" {
+			if v, err := strconv.Atoi(event.value["value"]); err == nil {
+				return v
+			}
+		}
+	}
+	return track
+}
+
+// sequence returns the file made of the tracks of the sequence number
+func (f *midiFile) sequence(number int) (*midiFile, error) {
+	tracks := make([][]*midiEvent, 0)
+	for i := range f.tracks {
+		if f.sequenceNumber(i) == number {
+			tracks = append(tracks, f.tracks[i])
+		}
+	}
+
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("%w: sequence %d does not exist", ErrInvalidOption, number)
+	}
+
+	return &midiFile{
+		format:       f.format,
+		timeDivision: f.timeDivision,
+		tracks:       tracks,
+		warnings:     f.warnings,
+		chunks:       f.chunks,
+	}, nil
+}
+
+// metaText returns the text of the first meta event of subType in any track
+func (f *midiFile) metaText(subType string) string {
+	for _, track := range f.tracks {
+		for _, event := range track {
+			if event.eventType == "meta" && event.subType == subType {
+				return event.value["value"]
+			}
+		}
+	}
+	return ""
+}
+
+// channelNames returns the name of each MIDI channel playing notes
+// given by the instrumentName (or trackName) event of the first track playing it
+// (empty if the track has no name)
+func (f *midiFile) channelNames() map[int]string {
+	names := make(map[int]string)
+	for _, track := range f.tracks {
+		var instrumentName, trackName string
+		for _, event := range track {
+			switch event.subType {
+			case "instrumentName":
+				if instrumentName == "" {
+					instrumentName = event.value["value"]
+				}
+			case "trackName":
+				if trackName == "" {
+					trackName = event.value["value"]
+				}
+			}
+		}
+
+		name := instrumentName
+		if name == "" {
+			name = trackName
+		}
+
+		for _, event := range track {
+			if event.subType != "noteOn" {
+				continue
+			}
+			if _, ok := names[int(event.channel)]; !ok {
+				names[int(event.channel)] = name
+			}
+		}
+	}
+	return names
+}
+
+// loopPoints returns the ticks of the markers of the loop
+// named by one of the conventions (e.g. "loopStart" and "loopEnd")
+func (f *midiFile) loopPoints() (start, end int, ok bool) {
+	start, end = -1, -1
+	for _, track := range f.tracks {
+		for _, event := range track {
+			if event.subType != "marker" {
+				continue
+			}
+
+			name := strings.ToLower(event.value["value"])
+			name = strings.NewReplacer(" ", "", "_", "", "-", "").Replace(name)
+			switch name {
+			case "loopstart", "[":
+				if start < 0 {
+					start = event.tick
+				}
+			case "loopend", "]":
+				if end < 0 {
+					end = event.tick
+				}
+			}
+		}
+	}
+	return start, end, start >= 0 && end > start
+}
+
+// cue is a named position of a marker or cuePoint event
+type cue struct {
+	tick int
+	name string
+}
+
+// cues returns the marker and cuePoint events of all tracks in order of time
+func (f *midiFile) cues() []cue {
+	cues := make([]cue, 0)
+	for _, track := range f.tracks {
+		for _, event := range track {
+			if event.subType == "marker" || event.subType == "cuePoint" {
+				cues = append(cues, cue{
+					tick: event.tick,
+					name: event.value["value"],
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(cues, func(i, j int) bool {
+		return cues[i].tick < cues[j].tick
+	})
+
+	return cues
+}
+
+// endTick returns the tick of the last event
+func (f *midiFile) endTick() int {
+	end := 0
+	for _, track := range f.tracks {
+		if len(track) > 0 {
+			end = maxInt(end, track[len(track)-1].tick)
+		}
 	}
+	return end
+}
+
+// scanAllTracks selects every track as the tempo track
+const scanAllTracks = -1
+
+type tempoChange struct {
+	tick                int
+	microsecondsPerBeat int
+}
+
+// tempoChanges collects the setTempo events of track
+// (or of all tracks if track is scanAllTracks) in order of time
+// at absolute ticks so that they may be interleaved with the notes
+// as in the single track of format 0
+func (f *midiFile) tempoChanges(track int) ([]tempoChange, error) {
+	tracks := f.tracks
+	if track != scanAllTracks {
+		if track < 0 || track >= len(f.tracks) {
+			return nil, fmt.Errorf("%w: tempo track %d does not exist in %d tracks", ErrInvalidOption, track, len(f.tracks))
+		}
+		tracks = f.tracks[track : track+1]
+	}
+
+	changes := make([]tempoChange, 0)
+	for _, events := range tracks {
+		for _, event := range events {
+			if event.subType == "setTempo" {
+				v, _ := strconv.Atoi(event.value["value"])
+				changes = append(changes, tempoChange{
+					tick:                event.tick,
+					microsecondsPerBeat: v,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].tick < changes[j].tick
+	})
+
+	return changes, nil
+}
+
+// smpte reports whether the delta times are subdivisions of SMPTE frames
+// instead of subdivisions of a beat
+func (f *midiFile) smpte() bool {
+	return (f.timeDivision >> 15) != 0
+}
+
+// framesPerSecond returns the SMPTE frame rate of the time division
+// whose upper byte is the negative frame rate in two's complement
+// (29 for drop-frame 29.97 fps)
+func (f *midiFile) framesPerSecond() (float64, error) {
+	switch fps := -int(int8(f.timeDivision >> 8)); fps {
+	case 24, 25, 30:
+		return float64(fps), nil
+	case 29:
+		return 30000.0 / 1001, nil
+	default:
+		return 0, fmt.Errorf("%w: SMPTE frame rate %d", ErrUnsupportedFormat, fps)
+	}
+}
+
+// ticksPerFrame returns the number of ticks in a SMPTE frame
+func (f *midiFile) ticksPerFrame() int {
+	return f.timeDivision & 0xff
+}
+
+// ticksPerBeat returns the number of ticks in a quarter note
+// which for SMPTE is the length of a beat at the default tempo of 120 BPM
+// (for Swing, Quantize and Metronome)
+func (f *midiFile) ticksPerBeat() int {
+	if !f.smpte() {
+		return f.timeDivision
+	}
+	fps, err := f.framesPerSecond()
+	if err != nil {
+		return 0
+	}
+	seconds := float64(time.MicrosecondsPerBeatDefault) / 1e6
+	return maxInt(int(math.Round(fps*float64(f.ticksPerFrame())*seconds)), 1)
+}
+
+// timer sets up a timer with the setTempo events of tempoTrack
+// or with the SMPTE frame rate which setTempo events do not change
+func (f *midiFile) timer(tempoTrack int) (*time.Timer, error) {
+	changes, err := f.tempoChanges(tempoTrack)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.smpte() {
+		fps, err := f.framesPerSecond()
+		if err != nil {
+			return nil, err
+		}
+		if f.ticksPerFrame() == 0 {
+			return nil, fmt.Errorf("%w: SMPTE frames of no ticks", ErrInvalidHeader)
+		}
+		return time.NewSMPTETimer(fps, f.ticksPerFrame()), nil
+	}
+
+	timer := time.NewTimer(f.timeDivision)
+
+	for _, change := range changes {
+		timer.AddCriticalPoint(change.tick, change.microsecondsPerBeat)
+	}
+
+	return timer, nil
+}
+
+// maxDenominatorExponent is the largest power of two of a time signature denominator
+// (a sixty-fourth note) beyond which the denominator would overflow
+const maxDenominatorExponent = 6
+
+// timeSignatures collects the timeSignature events of the first track
+// and returns them with the problems of the events
+func (f *midiFile) timeSignatures(timer *time.Timer) ([]TimeSig, []error) {
+	var (
+		timeSignatures = make([]TimeSig, 0)
+		warnings       []error
+	)
+	if len(f.tracks) == 0 {
+		return timeSignatures, warnings
+	}
+
+	for _, event := range f.tracks[0] {
+		if event.subType == "timeSignature" {
+			numerator, _ := strconv.Atoi(event.value["numerator"])
+			// denominator is stored as a negative power of two
+			denominator, _ := strconv.Atoi(event.value["denominator"])
+			if denominator > maxDenominatorExponent {
+				warnings = append(warnings, fmt.Errorf("%w: time signature denominator 2^%d at tick %d is clamped to %d", ErrInvalidEvent, denominator, event.tick, 1<<maxDenominatorExponent))
+				denominator = maxDenominatorExponent
+			}
+
+			timeSignatures = append(timeSignatures, TimeSig{
+				Tick:        event.tick,
+				Time:        timer.Time(event.tick),
+				Numerator:   numerator,
+				Denominator: 1 << uint(denominator),
+			})
+		}
+	}
+
+	return timeSignatures, warnings
 }
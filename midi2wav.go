@@ -16,19 +16,52 @@ package synth
 
 import (
 	"bytes"
-	"errors"
+	"encoding/json"
 	"fmt"
-	"github.com/entooone/simple-midi-synth/internal/time"
 	"io"
+	"math"
 	"sort"
 	"strconv"
+
+	"github.com/entooone/simple-midi-synth/internal/time"
 )
 
 type noteValue struct {
-	offset   float32
+	offset   float64
 	velocity int
+	// weight is the velocity counted for normalizing volume
+	// including the gain of EqualLoudness
+	weight int
+	// elapsed is the time in seconds the note sounded before offset
+	// if it continues a re-struck note
+	elapsed float64
+	channel byte
+	// changes of pitch at absolute time in seconds
+	bend []bendPoint
+	// skip is true for notes not to be rendered
+	skip bool
+	// cut is true for notes ended by a new note of the same pitch
+	// whose noteOff event is still to come
+	cut bool
+	// tick is the absolute tick where the note starts after quantizing
+	// which moved it by shift ticks
+	tick  int
+	shift int
 }
 
+// RetriggerPolicy decides how a noteOn event for a sounding note is handled
+type RetriggerPolicy int
+
+const (
+	// RetriggerStack overlaps the new note with the sounding note
+	RetriggerStack RetriggerPolicy = iota
+	// RetriggerCut ends the sounding note where the new note starts
+	RetriggerCut
+	// RetriggerContinue keeps the sounding note
+	// changing to the velocity of the new note where it starts
+	RetriggerContinue
+)
+
 type noteEvent struct {
 	velocity int
 	delta    uint
@@ -37,174 +70,757 @@ type noteEvent struct {
 
 type progression struct {
 	note      string
-	time      float32
+	time      float64
 	amplitude float32
-	offset    float32
+	offset    float64
+	channel   int
+	// detune in cents
+	cents float32
+	// render as percussive noise
+	noise bool
+	// time in seconds the note sounded before offset
+	elapsed float64
+	// changes of gain during the note
+	envelope []gainPoint
+	// changes of pitch relative to the start of the note
+	bend []bendPoint
+}
+
+// progressionOrder sorts notes by offset and then by pitch
+type progressionOrder struct {
+	notes     []*progression
+	semitones []int
+}
+
+func (p progressionOrder) Len() int { return len(p.notes) }
+
+func (p progressionOrder) Less(i, j int) bool {
+	if p.notes[i].offset != p.notes[j].offset {
+		return p.notes[i].offset < p.notes[j].offset
+	}
+	return p.semitones[i] < p.semitones[j]
+}
+
+func (p progressionOrder) Swap(i, j int) {
+	p.notes[i], p.notes[j] = p.notes[j], p.notes[i]
+	p.semitones[i], p.semitones[j] = p.semitones[j], p.semitones[i]
+}
+
+// sortProgression orders notes by offset and then by pitch
+// so that they are blended in the same order on every run
+func sortProgression(notes []*progression) {
+	semitones := make([]int, len(notes))
+	for i, note := range notes {
+		semitones[i], _ = semitoneFromNote(note.note)
+	}
+	sort.Stable(progressionOrder{notes: notes, semitones: semitones})
+}
+
+// progressionEnd returns the time in seconds where the last note ends
+func progressionEnd(notes []*progression) float64 {
+	var end float64
+	for _, note := range notes {
+		end = math.Max(end, note.offset+note.time)
+	}
+	return end
+}
+
+// writeProgressionJSON dumps notes as JSON
+// with amplitude scaled as rendered
+func writeProgressionJSON(w io.Writer, notes []*progression, amplitude float32) error {
+	type noteJSON struct {
+		Note      string  `json:"note"`
+		Offset    float64 `json:"offset"`
+		Time      float64 `json:"time"`
+		Amplitude float32 `json:"amplitude"`
+		Channel   int     `json:"channel"`
+	}
+
+	out := make([]noteJSON, len(notes))
+	for i, note := range notes {
+		out[i] = noteJSON{
+			Note:      note.note,
+			Offset:    note.offset,
+			Time:      note.time,
+			Amplitude: note.amplitude * amplitude,
+			Channel:   note.channel,
+		}
+	}
+
+	return json.NewEncoder(w).Encode(out)
 }
 
 // MIDIToWAV convert MIDI into WAV
+// It is safe to call from multiple goroutines concurrently.
 func MIDIToWAV(reader io.Reader) (*bytes.Buffer, error) {
-	midiStream, err := newMIDIStream(reader)
+	return MIDIToWAVWithOptions(reader, Options{})
+}
+
+// MIDIToWAVWithOptions convert MIDI into WAV with the given options
+// (encoded by Options.Encoder if set)
+func MIDIToWAVWithOptions(reader io.Reader, opts Options) (*bytes.Buffer, error) {
+	wav, _, err := render(reader, opts)
 	if err != nil {
 		return nil, err
 	}
-	header := midiStream.readChunk()
+	defer wav.release()
+
+	return wav.encodeBuffer(opts)
+}
 
-	if header.id != "MThd" || header.length != 6 {
-		return nil, errors.New("invalid header")
+// MIDIToWAVWriter convert MIDI into WAV written to writer with the given options
+// without holding a copy of the whole WAV (e.g. to write a long render to a file)
+func MIDIToWAVWriter(writer io.Writer, reader io.Reader, opts Options) error {
+	wav, _, err := render(reader, opts)
+	if err != nil {
+		return err
 	}
+	defer wav.release()
+
+	return wav.encode(opts, writer)
+}
 
-	headerStream, err := newMIDIStream(bytes.NewReader(header.data))
+// Result is the output of Convert
+type Result struct {
+	// WAV is the converted WAV
+	WAV *bytes.Buffer
+	// Envelope is the RMS level of the output for every EnvelopeInterval
+	// (nil unless Options.Envelope is set)
+	Envelope []float32
+	// Gain is the factor that scaled the amplitude of the notes
+	// to be passed as Options.Gain to render with the same loudness
+	// (1 if NormalizePerChannel is set as channels are scaled after rendering)
+	Gain float32
+}
+
+// Convert convert MIDI into WAV with the given options
+// and returns it with the requested statistics
+func Convert(reader io.Reader, opts Options) (*Result, error) {
+	wav, gain, err := render(reader, opts)
 	if err != nil {
 		return nil, err
 	}
-	headerStream.readUint16() // format type
-	trackCount := int(headerStream.readUint16())
-	timeDivision := int(headerStream.readUint16())
-	tracks := make([][]*midiEvent, 0)
-	prog := make([]*progression, 0)
-	events := make([]*noteEvent, 0)
-	var maxAmplitude float32
-	for i := 0; i < trackCount; i++ {
-		trackChunk := midiStream.readChunk()
+	defer wav.release()
 
-		if trackChunk.id != "MTrk" {
-			continue
-		}
+	result := &Result{
+		Gain: gain,
+	}
+	if opts.Envelope {
+		result.Envelope = wav.envelope(opts.envelopeInterval())
+	}
+	result.WAV, err = wav.encodeBuffer(opts)
+	if err != nil {
+		return nil, err
+	}
 
-		trackStream, err := newMIDIStream(bytes.NewReader(trackChunk.data))
-		if err != nil {
-			return nil, err
-		}
-		track := make([]*midiEvent, 0)
-		keep := true
+	return result, nil
+}
 
-		for keep && trackStream.byteOffset < trackChunk.length {
-			event := trackStream.readEvent()
-			track = append(track, event)
-		}
+// SampleLayout is the order of the samples of the channels returned by MIDIToFloat32
+type SampleLayout int
 
-		if keep {
-			tracks = append(tracks, track)
-		}
+const (
+	// LayoutInterleaved orders the samples by frame (L R L R ...)
+	LayoutInterleaved SampleLayout = iota
+	// LayoutPlanar orders the samples by channel (L L ... R R ...)
+	LayoutPlanar
+)
+
+// MIDIToFloat32 convert MIDI into normalized samples in Options.Layout
+// and returns them with the sample rate
+// (e.g. to be fed into an external encoder)
+func MIDIToFloat32(reader io.Reader, opts Options) ([]float32, uint32, error) {
+	wav, _, err := render(reader, opts)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	if (timeDivision >> 15) == 0 {
-		timer := time.NewTimer(timeDivision)
+	defer wav.release()
 
-		// set up timer with setTempo events
-		for i, delta := 0, 0; i < len(tracks[0]); i++ {
-			event := tracks[0][i]
-			delta += int(event.delta)
+	if opts.Layout == LayoutPlanar {
+		return wav.planar(), wav.sampleRate, nil
+	}
+	if wav.samples != nil {
+		// the samples are copied out of the file to be removed
+		return append([]float32(nil), wav.data[:wav.length]...), wav.sampleRate, nil
+	}
+	return wav.data[:wav.length], wav.sampleRate, nil
+}
 
-			if event.subType == "setTempo" {
-				v, _ := strconv.Atoi(event.value["value"])
-				timer.AddCriticalPoint(delta, v)
-				delta = 0
+// collectNotes pairs the noteOn and noteOff events of every track into notes
+// and returns them with the events for estimating the total velocity
+// and the tick where the last note ends
+func collectNotes(midi *midiFile, timer *time.Timer, opts Options) ([]*progression, []*noteEvent, int, error) {
+	var (
+		tracks       = midi.tracks
+		ticksPerBeat = midi.ticksPerBeat()
+		prog         = make([]*progression, 0)
+		events       = make([]*noteEvent, 0)
+	)
+
+	endTick := 0
+
+	// the beats of Swing follow the time signatures
+	var timeSignatures []TimeSig
+	if opts.Swing > 0 {
+		timeSignatures, _ = midi.timeSignatures(timer)
+	}
+
+	// noteTime converts the tick of a note event into seconds
+	noteTime := func(tick uint) float64 {
+		return timer.Time(swing(int(tick), timeSignatures, ticksPerBeat, opts.Swing))
+	}
+
+	grid := opts.quantizeGrid(ticksPerBeat)
+
+	// changes of the volume of each channel in any track
+	var expressions map[byte]*channelChanges
+	if opts.Expression {
+		expressions = midi.expressionChanges()
+	}
+
+	// generate note data
+	for i := 0; i < len(tracks); i++ {
+		track := tracks[i]
+		var delta uint
+		m := make(map[int][]*noteValue)
+
+		// last pitchBend event of each channel at absolute time
+		bends := make(map[byte]bendPoint)
+
+		// closeNote ends note at current delta and adds it to the progression
+		closeNote := func(semitone int, note *noteValue) {
+			channel := note.channel
+
+			// keep the duration unless quantized as well
+			duration := int(delta) - (note.tick - note.shift)
+			if opts.QuantizeDurations {
+				if d := quantize(duration, grid, opts.QuantizeStrength); d > 0 {
+					duration = d
+				}
+			}
+			end := uint(maxInt(note.tick+duration, note.tick))
+
+			// notes of other stems, of silenced channels or outside of MinNote and MaxNote
+			// are counted for normalizing volume but not rendered
+			stem := opts.stemChannel == nil || *opts.stemChannel == int(channel)
+			pitch, ok := transpose(semitone, opts.Transpose+opts.ChannelTranspose[int(channel)], opts.TransposePolicy)
+			if ok && stem && audible(opts.ChannelState, int(channel)) && opts.inRange(pitch) {
+				n, _ := noteFromSemitone(pitch)
+
+				// envelope is relative to the start of the note
+				var envelope []gainPoint
+				if opts.Expression {
+					start := note.tick - note.shift
+					for _, point := range expressions[channel].envelope(semitone, note.velocity, start, int(delta), noteTime) {
+						envelope = append(envelope, gainPoint{
+							time: point.time - note.offset,
+							gain: point.gain,
+						})
+					}
+				}
+
+				var bend []bendPoint
+				for _, point := range note.bend {
+					bend = append(bend, bendPoint{
+						time:  point.time - note.offset,
+						cents: point.cents,
+					})
+				}
+
+				prog = append(prog, &progression{
+					note:      n,
+					time:      (noteTime(end) - note.offset) * float64(opts.articulation()),
+					amplitude: float32(note.velocity) / 128,
+					offset:    note.offset,
+					elapsed:   note.elapsed,
+					channel:   int(channel),
+					cents:     opts.Detune[int(channel)] + opts.PitchShiftCents,
+					noise:     opts.PercussionNoise && channel == percussionChannel,
+					envelope:  envelope,
+					bend:      bend,
+				})
 			}
+
+			events = append(events, &noteEvent{
+				velocity: note.weight,
+				delta:    end,
+				note:     false,
+			})
+
+			endTick = maxInt(endTick, int(end))
 		}
 
-		// generate note data
-		for i := 0; i < len(tracks); i++ {
-			track := tracks[i]
-			var delta uint
-			m := make(map[int][]*noteValue)
+		for j := 0; j < len(track); j++ {
+			event := track[j]
+			delta = uint(event.tick)
 
-			for j := 0; j < len(track); j++ {
-				event := track[j]
-				delta += event.delta
+			if event.eventType == "channel" {
+				semitone, _ := strconv.Atoi(event.value["noteNumber"])
 
-				if event.eventType == "channel" {
-					semitone, _ := strconv.Atoi(event.value["noteNumber"])
+				if event.subType == "noteOn" {
+					v, _ := strconv.Atoi(event.value["velocity"])
+					start := quantize(int(delta), grid, opts.QuantizeStrength)
+					velocity := opts.velocity(v)
+					if opts.HumanizeVelocity > 0 {
+						velocity = humanizeVelocity(velocity, opts.HumanizeVelocity, opts.HumanizeSeed, semitone, int(event.channel), start)
+					}
+					note := &noteValue{
+						velocity: velocity,
+						offset:   noteTime(uint(start)),
+						channel:  event.channel,
+						// drop near-silent notes
+						skip:  v < opts.MinVelocity,
+						tick:  start,
+						shift: start - int(delta),
+					}
+					note.weight = loudnessWeight(semitone, note, opts)
+					// the note starts at the pitch of the last pitchBend event
+					if point, ok := bends[event.channel]; ok && opts.PitchBend != PitchBendIgnore {
+						note.bend = []bendPoint{point}
+					}
 
-					if event.subType == "noteOn" {
-						v, _ := strconv.Atoi(event.value["velocity"])
-						note := &noteValue{
-							velocity: v,
-							offset:   timer.Time(int(delta)),
+					// cut the sounding notes which are kept in the stack
+					// so that their noteOff events are ignored
+					if opts.Retrigger == RetriggerCut || opts.Retrigger == RetriggerContinue {
+						for _, sounding := range m[semitone] {
+							if !sounding.skip && sounding.channel == event.channel {
+								closeNote(semitone, sounding)
+								sounding.skip = true
+								sounding.cut = true
+
+								// continue the phase of the sounding note
+								// crossfading over the fade at its end
+								if opts.Retrigger == RetriggerContinue {
+									note.offset = math.Max(note.offset-fadeSeconds, sounding.offset)
+									note.elapsed = sounding.elapsed + note.offset - sounding.offset
+								}
+							}
 						}
+					}
 
-						// use stack for simultaneous identical notes
-						if _, ok := m[semitone]; ok {
-							m[semitone] = append(m[semitone], note)
-						} else {
-							m[semitone] = []*noteValue{note}
-						}
+					// use stack for simultaneous identical notes
+					if _, ok := m[semitone]; ok {
+						m[semitone] = append(m[semitone], note)
+					} else {
+						m[semitone] = []*noteValue{note}
+					}
 
-						// to determine maximum total velocity for normalizing volume
-						events = append(events, &noteEvent{
-							velocity: note.velocity,
-							delta:    delta,
-							note:     true,
-						})
-					} else if event.subType == "noteOff" {
-						if _, ok := m[semitone]; !ok {
-							return nil, fmt.Errorf("invalid semitone (%d)", semitone)
+					if note.skip {
+						continue
+					}
+
+					// to determine maximum total velocity for normalizing volume
+					events = append(events, &noteEvent{
+						velocity: note.weight,
+						delta:    uint(start),
+						note:     true,
+					})
+				} else if event.subType == "noteOff" {
+					// the first cut note of the channel whose noteOff is ignored
+					// or else the last note of the channel
+					stack := m[semitone]
+					k := -1
+					for n := range stack {
+						if stack[n].cut && stack[n].channel == event.channel {
+							k = n
+							break
 						}
-						note := m[semitone][len(m[semitone])-1]
-						m[semitone] = m[semitone][:len(m[semitone])-1]
-						n, _ := noteFromSemitone(semitone)
-						prog = append(prog, &progression{
-							note:      n,
-							time:      timer.Time(int(delta)) - note.offset,
-							amplitude: float32(note.velocity) / 128,
-							offset:    note.offset,
-						})
+					}
+					for n := len(stack) - 1; n >= 0 && k < 0; n-- {
+						if stack[n].channel == event.channel {
+							k = n
+						}
+					}
+					if k < 0 {
+						opts.warn(fmt.Errorf("%w: noteOff without noteOn (%d) on channel %d at tick %d", ErrInvalidNote, semitone, event.channel, delta))
+						continue
+					}
+					note := stack[k]
+					m[semitone] = append(stack[:k], stack[k+1:]...)
+					if note.skip {
+						continue
+					}
 
-						events = append(events, &noteEvent{
-							velocity: note.velocity,
-							delta:    delta,
-							note:     false,
-						})
+					closeNote(semitone, note)
+				} else if event.subType == "pitchBend" && opts.PitchBend != PitchBendIgnore {
+					value, _ := strconv.Atoi(event.value["value"])
+					point := bendPoint{
+						time:  noteTime(delta),
+						cents: bendCents(value, opts.pitchBendRange()),
+					}
+					bends[event.channel] = point
+
+					// bend the sounding notes of the channel
+					for _, stack := range m {
+						for _, note := range stack {
+							if note.channel == event.channel && !note.skip {
+								note.bend = append(note.bend, point)
+							}
+						}
 					}
 				}
 			}
 		}
+	}
 
-		sort.Slice(events, func(i, j int) bool {
-			return (events[i].delta < events[j].delta) || ((events[i].delta == events[j].delta) && ((events[i].note != events[j].note) && events[j].note))
-		})
+	return prog, events, endTick, nil
+}
 
-		var (
-			maxVelocity = 1
-			velocity    = 1
-			maxChord    = 0
-			chord       = 0
-		)
+// previewFadeSeconds is the length of the fade-out at the end of a preview
+const previewFadeSeconds = 0.05
 
-		for _, event := range events {
-			if event.note {
-				velocity += event.velocity
-				chord++
+// Preview convert at most maxSeconds of MIDI from the first note
+// into a mono WAV fading out at the end (e.g. for a quick listen)
+// and returns ErrInvalidOption if maxSeconds is not positive
+func Preview(reader io.Reader, maxSeconds float32) (*bytes.Buffer, error) {
+	if maxSeconds <= 0 {
+		return nil, fmt.Errorf("%w: preview of %g seconds", ErrInvalidOption, maxSeconds)
+	}
 
-				if velocity > maxVelocity {
-					maxVelocity = velocity
-				}
+	opts := Options{
+		TrimSilence: true,
+		ClipEnd:     maxSeconds,
+	}
+	wav, _, err := render(reader, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer wav.release()
+	wav.fadeOut(previewFadeSeconds)
 
-				if chord > maxChord {
-					maxChord = chord
-				}
-			} else {
-				velocity -= event.velocity
-				chord--
+	return wav.encodeBuffer(opts)
+}
+
+// render synthesizes the notes of MIDI into sound data
+// and returns it with the factor scaling the amplitude of the notes
+func render(reader io.Reader, opts Options) (*wavData, float32, error) {
+	if err := opts.validate(); err != nil {
+		return nil, 0, err
+	}
+
+	midi, err := parseMIDIWithHandlers(reader, nil, opts.MaxTracks)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts.warn(midi.warnings...)
+
+	if opts.SelectSequence {
+		midi, err = midi.sequence(opts.SequenceNumber)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var (
+		prog         []*progression
+		maxAmplitude float32
+		// times where the repetitions of Loops start and start over
+		loopStart float64
+		seams     []float64
+	)
+
+	timer, err := midi.timer(opts.TempoTrack)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		events  []*noteEvent
+		endTick int
+	)
+	prog, events, endTick, err = collectNotes(midi, timer, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	if opts.HumanizeTiming > 0 {
+		humanize(prog, float64(opts.HumanizeTiming)/1000, opts.HumanizeSeed)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return (events[i].delta < events[j].delta) || ((events[i].delta == events[j].delta) && ((events[i].note != events[j].note) && events[j].note))
+	})
+
+	var (
+		maxVelocity = 1
+		velocity    = 1
+		maxChord    = 0
+		chord       = 0
+	)
+
+	for _, event := range events {
+		if event.note {
+			velocity += event.velocity
+			chord++
+
+			if velocity > maxVelocity {
+				maxVelocity = velocity
+			}
+
+			if chord > maxChord {
+				maxChord = chord
+			}
+		} else {
+			velocity -= event.velocity
+			chord--
+		}
+	}
+
+	// scaling factor for amplitude
+	maxAmplitude = 128 / float32(maxVelocity) * opts.headroomGain()
+	if opts.DisableNormalization {
+		maxAmplitude = 1
+	}
+	if opts.Gain > 0 {
+		maxAmplitude = opts.Gain
+	}
+
+	// render at a higher sample rate to be decimated
+	oversample := maxInt(opts.Oversample, 1)
+
+	wav, err := newOutput(opts, oversample)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if opts.BroadcastExtension != nil {
+		bext := *opts.BroadcastExtension
+		if bext.Description == "" {
+			bext.Description = midi.metaText("trackName")
+		}
+		wav.addChunk("bext", bext.bytes())
+		wav.bext = &bext
+	}
+
+	if !opts.DisableCopyright {
+		if copyright := midi.metaText("copyrightNotice"); copyright != "" {
+			wav.addChunk("LIST", infoList(infoField{"ICOP", copyright}))
+			wav.copyright = copyright
+		}
+	}
+
+	// the size is checked before clicks and repetitions are generated
+	// as their number grows with the length of the output
+	if opts.MaxOutputBytes > 0 {
+		end := progressionEnd(prog)
+		if opts.Loops > 1 {
+			start, stop, ok := midi.loopPoints()
+			if !ok {
+				start, stop = 0, midi.endTick()
+			}
+			if length := timer.Time(stop) - timer.Time(start); length > 0 && end > timer.Time(start) {
+				end += float64(opts.Loops-1) * length
 			}
 		}
+		if opts.TrimSilence {
+			end -= progressionStart(prog)
+		}
+		if opts.ClipEnd > 0 {
+			end = math.Min(end, float64(opts.ClipEnd))
+		}
+		end -= float64(opts.ClipStart)
 
-		// scaling factor for amplitude
-		maxAmplitude = 128 / float32(maxVelocity)
-	} else {
-		// use frames per second
-		// not yet implemented
+		if size := wav.size(end, opts.sampleRate()); size > opts.MaxOutputBytes {
+			return nil, 0, fmt.Errorf("%w: %d bytes exceed %d bytes", ErrTooLarge, size, opts.MaxOutputBytes)
+		}
+	}
 
-		return nil, errors.New("unsupported format")
+	// the clicks belong to the mix and not to any stem
+	if opts.Metronome && opts.stemChannel == nil {
+		volume := opts.MetronomeVolume
+		if volume <= 0 {
+			volume = defaultMetronomeVolume
+		}
+
+		timeSignatures, warnings := midi.timeSignatures(timer)
+		opts.warn(warnings...)
+
+		// clicks are rendered at the volume whatever the normalization
+		for _, click := range metronomeClicks(timeSignatures, midi.ticksPerBeat(), endTick, timer, volume) {
+			click.amplitude /= maxAmplitude
+			prog = append(prog, click)
+		}
 	}
 
-	wav, _ := newWAV(1, 44100, 16, true, make([]byte, 0))
+	if opts.Loops > 1 {
+		start, end, ok := midi.loopPoints()
+		if !ok {
+			start, end = 0, midi.endTick()
+		}
+		prog = loop(prog, timer.Time(start), timer.Time(end), opts.Loops)
+
+		loopStart = timer.Time(start)
+		for i := 1; i < opts.Loops; i++ {
+			seams = append(seams, loopStart+float64(i)*(timer.Time(end)-loopStart))
+		}
+	}
+
+	// origin is the time of the input at the start of the output
+	origin := 0.0
+	if opts.TrimSilence {
+		origin = progressionStart(prog)
+		prog = shift(prog, -origin)
+	}
+
+	if opts.ClipStart > 0 || opts.ClipEnd > 0 {
+		origin += float64(opts.ClipStart)
+		prog = clip(prog, float64(opts.ClipStart), float64(opts.ClipEnd))
+	}
+	sortProgression(prog)
+
+	if opts.MaxOutputBytes > 0 {
+		if size := wav.size(progressionEnd(prog), opts.sampleRate()); size > opts.MaxOutputBytes {
+			return nil, 0, fmt.Errorf("%w: %d bytes exceed %d bytes", ErrTooLarge, size, opts.MaxOutputBytes)
+		}
+	}
+
+	if opts.DebugWriter != nil {
+		if err := writeProgressionJSON(opts.DebugWriter, prog, maxAmplitude); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// the clicks are mixed in after the channels are normalized
+	// so that NormalizePerChannel and AutoGain do not change their level
+	// (aligned with the notes which are moved together if before zero)
+	if start := progressionStart(prog); start < 0 {
+		prog = shift(prog, -start)
+	}
+	prog, clicks := splitClicks(prog)
+	var metronome *wavData
+	if len(clicks) > 0 {
+		metronome = wav.bus()
+		metronome.writeProgression(clicks, maxAmplitude, []int{}, true, true, 1)
+		metronome.decimate(oversample)
+		metronome.resample(opts.sampleRate(), opts.Interpolation)
+	}
+
+	// channels are scaled after rendering
+	perChannel := opts.NormalizePerChannel && !opts.DisableNormalization && opts.Gain <= 0
+	if perChannel {
+		maxAmplitude = 1
+	}
+
+	// the reverb is fed by the notes at the levels of ReverbSend
+	// scaled in the same way as the output
+	send := wav
+	if len(opts.ImpulseResponse) > 0 && len(opts.ReverbSend) > 0 {
+		send = wav.bus()
+		send.writeProgression(sendProgression(prog, opts.ReverbSend), maxAmplitude, []int{}, true, true, 1)
+		send.decimate(oversample)
+		send.resample(opts.sampleRate(), opts.Interpolation)
+	}
+
+	opts.warn(wav.writeProgression(prog, maxAmplitude, []int{}, true, true, 1)...)
+	wav.decimate(oversample)
+	wav.resample(opts.sampleRate(), opts.Interpolation)
+
+	if perChannel {
+		gains := wav.channelGains(opts.headroomGain())
+		wav.scaleChannels(gains)
+		if send != wav {
+			send.scaleChannels(gains)
+		}
+	}
+
+	if opts.AutoGain {
+		wav.autoGain(opts.headroomGain(), float64(opts.autoGainWindow()))
+	}
+
+	if metronome != nil {
+		wav.mix(metronome)
+		if send != wav {
+			send.mix(metronome)
+		}
+		opts.warn(metronome.storageErrs...)
+		metronome.release()
+	}
+
+	if opts.GateThreshold < 0 {
+		wav.gate(opts.gate())
+	}
+
+	if opts.LoopCrossfade > 0 && len(seams) > 0 {
+		for i := range seams {
+			seams[i] -= origin
+		}
+		wav.crossfade(loopStart-origin, seams, float64(opts.LoopCrossfade)/1000)
+	}
+
+	err = wav.applyEffects(send, opts)
+	if send != wav {
+		opts.warn(send.storageErrs...)
+		send.release()
+	}
+	opts.warn(wav.storageErrs...)
+	if err != nil {
+		wav.release()
+		return nil, 0, err
+	}
+
+	return wav, maxAmplitude, nil
+}
+
+// newOutput creates empty sound data with the format and the sound of opts
+// at oversample times the sample rate
+func newOutput(opts Options, oversample int) (*wavData, error) {
+	audioFormat := uint16(wavFormatPCM)
+	switch {
+	case opts.FloatSamples:
+		audioFormat = wavFormatFloat
+	case opts.ChannelMask != 0:
+		audioFormat = wavFormatExtensible
+	}
+
+	wav, err := newWAV(audioFormat, opts.numChannels(), 44100*uint32(oversample), opts.bitsPerSample(), true, make([]byte, 0))
 	if err != nil {
 		return nil, err
 	}
+	if opts.ChannelMask != 0 {
+		wav.channelMask = opts.ChannelMask
+	}
+	wav.fadeCurve = opts.FadeCurve
+	wav.noiseColor = opts.NoiseColor
+	wav.noiseSeed = opts.NoiseSeed
+	wav.phaseSpread = math.Min(float64(opts.PhaseSpread), 1)
+	wav.phaseSeed = opts.PhaseSeed
+	wav.waveform = opts.Waveform
+	wav.squareDuty = opts.squareDuty()
+	wav.equalLoudness = opts.EqualLoudness
+	wav.pitchBend = opts.PitchBend
+	wav.lowMemory = opts.LowMemory
+	wav.tempDir = opts.TempDir
+
+	return wav, nil
+}
+
+// applyEffects processes the rendered sound data with the effects of opts
+// feeding the reverb from send (which may be w itself)
+func (w *wavData) applyEffects(send *wavData, opts Options) error {
+	if len(opts.ImpulseResponse) > 0 {
+		ir, err := decodeWAV(opts.ImpulseResponse)
+		if err != nil {
+			return err
+		}
+		w.convolveReverb(ir, send, opts.reverbMix())
+	}
+
+	if opts.HaasDelay > 0 {
+		w.delayChannel(opts.HaasChannel, opts.HaasDelay/1000)
+	}
+
+	if opts.DownmixMono {
+		if opts.DownmixCheckPhase && opts.DownmixMode == DownmixAverage {
+			if c := w.correlation(); c < 0 {
+				opts.warn(fmt.Errorf("%w: correlation %.2f cancels out on downmix", ErrOutOfPhase, c))
+			}
+		}
+		w.downmix(opts.DownmixMode)
+	}
 
-	wav.writeProgression(prog, maxAmplitude, []int{0}, true, true, 1)
+	if opts.MidSide {
+		w.midSide()
+	}
 
-	return wav.toBuffer(), nil
+	return nil
 }
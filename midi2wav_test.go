@@ -0,0 +1,792 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"testing"
+)
+
+// collect parses data and collects its notes with opts sorted by time
+// (of the sequence of opts if selected)
+func collect(t *testing.T, data []byte, opts Options) []*progression {
+	t.Helper()
+
+	midi, err := parseMIDI(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("parseMIDI() error = %v", err)
+	}
+	if opts.SelectSequence {
+		midi, err = midi.sequence(opts.SequenceNumber)
+		if err != nil {
+			t.Fatalf("sequence() error = %v", err)
+		}
+	}
+	timer, err := midi.timer(opts.TempoTrack)
+	if err != nil {
+		t.Fatalf("timer() error = %v", err)
+	}
+	prog, _, _, err := collectNotes(midi, timer, opts)
+	if err != nil {
+		t.Fatalf("collectNotes() error = %v", err)
+	}
+	sortProgression(prog)
+
+	return prog
+}
+
+func TestShortInput(t *testing.T) {
+	header := smf(0, 480)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: []byte{}},
+		{name: "3 bytes", data: []byte("MTh")},
+		{name: "header without division", data: header[:len(header)-1]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := MIDIToWAV(bytes.NewReader(tt.data)); !errors.Is(err, ErrTruncated) {
+				t.Errorf("MIDIToWAV() error = %v, want %v", err, ErrTruncated)
+			}
+			if _, err := ParseMIDI(bytes.NewReader(tt.data)); !errors.Is(err, ErrTruncated) {
+				t.Errorf("ParseMIDI() error = %v, want %v", err, ErrTruncated)
+			}
+		})
+	}
+}
+
+func TestTempoTrack(t *testing.T) {
+	data := smf(1, 480,
+		track(event(0, 0xff, 0x03, 0x04, 's', 'o', 'n', 'g')),
+		track(noteOn(480, 60, 100), noteOff(480, 60)),
+		track(tempo(0, 250000)),
+	)
+
+	tests := []struct {
+		name       string
+		tempoTrack int
+		offset     float64
+		duration   float64
+	}{
+		{name: "first track without tempo", tempoTrack: 0, offset: 0.5, duration: 0.5},
+		{name: "third track", tempoTrack: 2, offset: 0.25, duration: 0.25},
+		{name: "all tracks", tempoTrack: -1, offset: 0.25, duration: 0.25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog := collect(t, data, Options{TempoTrack: tt.tempoTrack})
+			if len(prog) != 1 {
+				t.Fatalf("collected %d notes, want 1", len(prog))
+			}
+			if prog[0].offset != tt.offset || prog[0].time != tt.duration {
+				t.Errorf("note at %g s for %g s, want at %g s for %g s", prog[0].offset, prog[0].time, tt.offset, tt.duration)
+			}
+		})
+	}
+}
+
+func TestSelectSequence(t *testing.T) {
+	// sequenceNumber events
+	first := event(0, 0xff, 0x00, 0x02, 0x00, 0x01)
+	second := event(0, 0xff, 0x00, 0x02, 0x00, 0x02)
+
+	data := smf(2, 480,
+		track(first, tempo(0, 250000)),
+		track(first, noteOn(0, 60, 100), noteOff(480, 60)),
+		track(second, noteOn(0, 64, 100), noteOff(480, 64)),
+		track(second, noteOn(0, 67, 100), noteOff(960, 67)),
+	)
+
+	tests := []struct {
+		name   string
+		number int
+		notes  []string
+		times  []float64
+	}{
+		// the first track of the sequence holds its tempo map
+		{name: "first sequence", number: 1, notes: []string{"C4"}, times: []float64{0.25}},
+		{name: "second sequence", number: 2, notes: []string{"E4", "G4"}, times: []float64{0.5, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog := collect(t, data, Options{SelectSequence: true, SequenceNumber: tt.number})
+			if len(prog) != len(tt.notes) {
+				t.Fatalf("collected %d notes, want %d", len(prog), len(tt.notes))
+			}
+			for i, p := range prog {
+				if p.note != tt.notes[i] || p.time != tt.times[i] {
+					t.Errorf("note %d is %s for %g s, want %s for %g s", i, p.note, p.time, tt.notes[i], tt.times[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRetrigger(t *testing.T) {
+	restruck := smf(0, 480, track(
+		noteOn(0, 60, 100),
+		noteOn(480, 60, 100),
+		noteOff(480, 60),
+		noteOff(480, 60),
+	))
+	// the same pitch on channel 0 and then on channel 1
+	channels := smf(0, 480, track(
+		noteOn(0, 60, 100),
+		event(480, 0x91, 60, 100),
+		noteOff(480, 60),
+		event(480, 0x81, 60, 0),
+	))
+
+	type note struct {
+		offset, time float64
+		channel      int
+	}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		policy RetriggerPolicy
+		notes  []note
+	}{
+		{
+			name:   "stack",
+			data:   restruck,
+			policy: RetriggerStack,
+			// the first noteOff ends the last note
+			notes: []note{{0, 1.5, 0}, {0.5, 0.5, 0}},
+		},
+		{
+			name:   "cut",
+			data:   restruck,
+			policy: RetriggerCut,
+			// the first noteOff belongs to the cut note
+			notes: []note{{0, 0.5, 0}, {0.5, 1, 0}},
+		},
+		{
+			name:   "continue",
+			data:   restruck,
+			policy: RetriggerContinue,
+			notes:  []note{{0, 0.5, 0}, {0.5 - fadeSeconds, 1 + fadeSeconds, 0}},
+		},
+		{
+			name:   "stack on other channels",
+			data:   channels,
+			policy: RetriggerStack,
+			notes:  []note{{0, 1, 0}, {0.5, 1, 1}},
+		},
+		{
+			name:   "cut on other channels",
+			data:   channels,
+			policy: RetriggerCut,
+			notes:  []note{{0, 1, 0}, {0.5, 1, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog := collect(t, tt.data, Options{Retrigger: tt.policy})
+			if len(prog) != len(tt.notes) {
+				t.Fatalf("collected %d notes, want %d", len(prog), len(tt.notes))
+			}
+			for i, p := range prog {
+				want := tt.notes[i]
+				if math.Abs(p.offset-want.offset) > 1e-9 || math.Abs(p.time-want.time) > 1e-9 || p.channel != want.channel {
+					t.Errorf("note %d at %g s for %g s on channel %d, want at %g s for %g s on channel %d",
+						i, p.offset, p.time, p.channel, want.offset, want.time, want.channel)
+				}
+			}
+		})
+	}
+}
+
+func TestLongSequenceTiming(t *testing.T) {
+	const (
+		ticksPerBeat        = 96
+		microsecondsPerBeat = 483871
+		step                = 7
+	)
+
+	tests := []struct {
+		name  string
+		notes int
+	}{
+		{name: "100 notes", notes: 100},
+		{name: "20000 notes", notes: 20000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := [][]byte{tempo(0, microsecondsPerBeat)}
+			for i := 0; i < tt.notes; i++ {
+				events = append(events, noteOn(0, 60, 100), noteOff(3, 60), event(step-3, 0xff, 0x01, 0x00))
+			}
+			prog := collect(t, smf(0, ticksPerBeat, track(events...)), Options{})
+			if len(prog) != tt.notes {
+				t.Fatalf("collected %d notes, want %d", len(prog), tt.notes)
+			}
+
+			w, err := newWAV(wavFormatPCM, 1, 44100, 16, true, make([]byte, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the ideal frame of the last note computed without rounding in between
+			tick := (tt.notes - 1) * step
+			ideal := float64(tick) * microsecondsPerBeat * 44100 / ticksPerBeat / 1e6
+			if got := w.frame(prog[len(prog)-1].offset); math.Abs(float64(got)-ideal) > 1 {
+				t.Errorf("last note starts at frame %d, want %g", got, ideal)
+			}
+		})
+	}
+}
+
+func TestSortProgression(t *testing.T) {
+	tests := []struct {
+		name  string
+		notes []*progression
+		want  []string
+	}{
+		{
+			name: "by offset",
+			notes: []*progression{
+				{note: "C4", offset: 1}, {note: "C4", offset: 0.5}, {note: "C4", offset: 0},
+			},
+			want: []string{"C4@0", "C4@0.5", "C4@1"},
+		},
+		{
+			name: "by pitch at the same offset",
+			notes: []*progression{
+				{note: "G4"}, {note: "C5"}, {note: "C4"}, {note: "E4"}, {note: "C-1#"},
+			},
+			want: []string{"C-1#@0", "C4@0", "E4@0", "G4@0", "C5@0"},
+		},
+		{
+			name: "by offset and then by pitch",
+			notes: []*progression{
+				{note: "E4", offset: 1}, {note: "G4"}, {note: "C4", offset: 1}, {note: "C4"},
+			},
+			want: []string{"C4@0", "G4@0", "C4@1", "E4@1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sortProgression(tt.notes)
+			for i, note := range tt.notes {
+				if got := fmt.Sprintf("%s@%g", note.note, note.offset); got != tt.want[i] {
+					t.Errorf("note %d = %s, want %s", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDeterministicOutput(t *testing.T) {
+	// chords struck at once on several tracks and channels
+	chord := func(channel byte, notes ...byte) []byte {
+		var events [][]byte
+		for _, n := range notes {
+			events = append(events, event(0, 0x90|channel, n, 90))
+		}
+		for i, n := range notes {
+			delta := uint(0)
+			if i == 0 {
+				delta = 240
+			}
+			events = append(events, event(delta, 0x80|channel, n, 0))
+		}
+		return track(events...)
+	}
+	data := smf(1, 480,
+		chord(0, 60, 64, 67, 72, 76),
+		chord(1, 48, 55, 60, 64),
+		chord(2, 61, 63, 66, 70, 73, 78),
+		chord(3, 36, 43, 60, 67),
+	)
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "mono", opts: Options{}},
+		{name: "stereo float", opts: Options{Channels: 2, FloatSamples: true}},
+		{name: "expression and humanized", opts: Options{Expression: true, HumanizeVelocity: 10, HumanizeSeed: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var first []byte
+			for i := 0; i < 10; i++ {
+				buf, err := MIDIToWAVWithOptions(bytes.NewReader(data), tt.opts)
+				if err != nil {
+					t.Fatalf("MIDIToWAVWithOptions() error = %v", err)
+				}
+				if first == nil {
+					first = buf.Bytes()
+				} else if !bytes.Equal(buf.Bytes(), first) {
+					t.Fatalf("run %d differs from the first run", i)
+				}
+			}
+		})
+	}
+}
+
+func TestRetriggerLouder(t *testing.T) {
+	// a note re-struck louder in the middle of its hold
+	data := smf(0, 480, track(
+		noteOn(0, 69, 32),
+		noteOn(480, 69, 96),
+		noteOff(480, 69),
+		noteOff(0, 69),
+	))
+
+	// peak returns the largest absolute sample from start to end seconds
+	peak := func(samples []float32, start, end float64) float64 {
+		var p float64
+		for _, s := range samples[int(start*44100):int(end*44100)] {
+			p = math.Max(p, math.Abs(float64(s)))
+		}
+		return p
+	}
+
+	tests := []struct {
+		name   string
+		policy RetriggerPolicy
+		// peaks before and after the re-attack
+		before, after float64
+	}{
+		// the voices of both notes are summed
+		{name: "stack", policy: RetriggerStack, before: 0.25, after: 1},
+		{name: "cut", policy: RetriggerCut, before: 0.25, after: 0.75},
+		{name: "continue", policy: RetriggerContinue, before: 0.25, after: 0.75},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, _, err := MIDIToFloat32(bytes.NewReader(data), Options{
+				Retrigger:            tt.policy,
+				Waveform:             WaveformSine,
+				DisableNormalization: true,
+			})
+			if err != nil {
+				t.Fatalf("MIDIToFloat32() error = %v", err)
+			}
+			if got := peak(samples, 0.1, 0.4); math.Abs(got-tt.before) > 0.01 {
+				t.Errorf("peak before the re-attack = %g, want %g", got, tt.before)
+			}
+			if got := peak(samples, 0.6, 0.9); math.Abs(got-tt.after) > 0.01 {
+				t.Errorf("peak after the re-attack = %g, want %g", got, tt.after)
+			}
+		})
+	}
+
+	// the continued note is split at the re-attack keeping its phase
+	prog := collect(t, data, Options{Retrigger: RetriggerContinue})
+	if len(prog) != 2 {
+		t.Fatalf("collected %d notes, want 2", len(prog))
+	}
+	if prog[0].amplitude != 0.25 || prog[1].amplitude != 0.75 {
+		t.Errorf("amplitudes = %g and %g, want 0.25 and 0.75", prog[0].amplitude, prog[1].amplitude)
+	}
+	if prog[1].elapsed != prog[1].offset {
+		t.Errorf("continued note has sounded for %g s at %g s", prog[1].elapsed, prog[1].offset)
+	}
+}
+
+func TestTempoChanges(t *testing.T) {
+	data := smf(1, 480,
+		track(tempo(0, 500000), tempo(960, 1000000), tempo(960, 250000)),
+		track(
+			noteOn(0, 60, 100), noteOff(240, 60),
+			noteOn(240, 62, 100), noteOff(240, 62),
+			noteOn(240, 64, 100), noteOff(240, 64),
+			noteOn(240, 65, 100), noteOff(240, 65),
+			noteOn(240, 67, 100), noteOff(240, 67),
+			noteOn(240, 69, 100), noteOff(240, 69),
+		),
+		// a note held across the first tempo change
+		track(noteOn(720, 48, 100), noteOff(480, 48)),
+	)
+
+	tests := []struct {
+		note     string
+		offset   float64
+		duration float64
+	}{
+		{note: "C4", offset: 0, duration: 0.25},
+		{note: "D4", offset: 0.5, duration: 0.25},
+		{note: "C3", offset: 0.75, duration: 0.75},
+		{note: "E4", offset: 1, duration: 0.5},
+		{note: "F4", offset: 2, duration: 0.5},
+		{note: "G4", offset: 3, duration: 0.125},
+		{note: "A4", offset: 3.25, duration: 0.125},
+	}
+
+	prog := collect(t, data, Options{})
+	if len(prog) != len(tests) {
+		t.Fatalf("collected %d notes, want %d", len(prog), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.note, func(t *testing.T) {
+			p := prog[i]
+			if p.note != tt.note || p.offset != tt.offset || p.time != tt.duration {
+				t.Errorf("%s at %g s for %g s, want %s at %g s for %g s", p.note, p.offset, p.time, tt.note, tt.offset, tt.duration)
+			}
+		})
+	}
+}
+
+func TestEmptyFirstTrack(t *testing.T) {
+	notes := track(noteOn(480, 60, 100), noteOff(480, 60))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		warnings int
+		notes    int
+	}{
+		{name: "chunk without data", data: smf(1, 480, []byte{}, notes), warnings: 1, notes: 1},
+		{name: "only endOfTrack", data: smf(1, 480, track(), notes), notes: 1},
+		{name: "all tracks without data", data: smf(1, 480, []byte{}, []byte{}), warnings: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings []error
+			_, err := MIDIToWAVWithOptions(bytes.NewReader(tt.data), Options{
+				Warn: func(err error) { warnings = append(warnings, err) },
+			})
+			if err != nil {
+				t.Fatalf("MIDIToWAVWithOptions() error = %v", err)
+			}
+			if len(warnings) != tt.warnings {
+				t.Fatalf("warned %v, want %d warnings", warnings, tt.warnings)
+			}
+			for _, w := range warnings {
+				if !errors.Is(w, ErrTruncated) {
+					t.Errorf("warning %v is not %v", w, ErrTruncated)
+				}
+			}
+
+			// the notes of the second track follow the default tempo
+			prog := collect(t, tt.data, Options{})
+			if len(prog) != tt.notes {
+				t.Fatalf("collected %d notes, want %d", len(prog), tt.notes)
+			}
+			for _, p := range prog {
+				if p.offset != 0.5 || p.time != 0.5 {
+					t.Errorf("note at %g s for %g s, want at 0.5 s for 0.5 s", p.offset, p.time)
+				}
+			}
+		})
+	}
+}
+
+func TestFormat0TempoChanges(t *testing.T) {
+	type note struct {
+		name           string
+		offset, length float64
+	}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		notes []note
+	}{
+		{
+			name: "between notes",
+			data: smf(0, 480, track(
+				noteOn(0, 60, 100), noteOff(480, 60),
+				tempo(0, 1000000),
+				noteOn(0, 62, 100), noteOff(480, 62),
+				noteOn(480, 64, 100), noteOff(480, 64),
+			)),
+			notes: []note{{"C4", 0, 0.5}, {"D4", 0.5, 1}, {"E4", 2.5, 1}},
+		},
+		{
+			name: "during a held note",
+			data: smf(0, 480, track(
+				noteOn(0, 60, 100),
+				tempo(480, 250000),
+				noteOff(480, 60),
+				noteOn(0, 62, 100), noteOff(480, 62),
+			)),
+			notes: []note{{"C4", 0, 0.75}, {"D4", 0.75, 0.25}},
+		},
+		{
+			name: "before the first note",
+			data: smf(0, 96, track(
+				tempo(0, 400000),
+				noteOn(96, 60, 100), noteOff(48, 60),
+				tempo(48, 800000),
+				noteOn(0, 62, 100), noteOff(96, 62),
+			)),
+			notes: []note{{"C4", 0.4, 0.2}, {"D4", 0.8, 0.8}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog := collect(t, tt.data, Options{})
+			if len(prog) != len(tt.notes) {
+				t.Fatalf("collected %d notes, want %d", len(prog), len(tt.notes))
+			}
+			for i, want := range tt.notes {
+				p := prog[i]
+				if p.note != want.name || math.Abs(p.offset-want.offset) > 1e-9 || math.Abs(p.time-want.length) > 1e-9 {
+					t.Errorf("%s at %g s for %g s, want %s at %g s for %g s", p.note, p.offset, p.time, want.name, want.offset, want.length)
+				}
+			}
+		})
+	}
+}
+
+func TestPreview(t *testing.T) {
+	// a note after a second of silence
+	data := smf(0, 480, track(noteOn(960, 69, 100), noteOff(1920, 69)))
+
+	tests := []struct {
+		name       string
+		maxSeconds float32
+		err        error
+		seconds    float64
+	}{
+		{name: "shorter than the notes", maxSeconds: 0.5, seconds: 0.5},
+		{name: "longer than the notes", maxSeconds: 10, seconds: 2},
+		{name: "zero", maxSeconds: 0, err: ErrInvalidOption},
+		{name: "negative", maxSeconds: -1, err: ErrInvalidOption},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := Preview(bytes.NewReader(data), tt.maxSeconds)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Preview() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			chunks := riffChunks(t, buf.Bytes())
+			samples := chunks["data"]
+			if channels := binary.LittleEndian.Uint16(chunks["fmt "][2:4]); channels != 1 {
+				t.Errorf("%d channels, want 1", channels)
+			}
+			// the leading silence is trimmed
+			if frames := float64(len(samples)/2) / 44100; math.Abs(frames-tt.seconds) > 0.01 {
+				t.Errorf("preview of %g s, want %g s", frames, tt.seconds)
+			}
+			// and the end fades out
+			if last := int16(binary.LittleEndian.Uint16(samples[len(samples)-2:])); last != 0 {
+				t.Errorf("last sample = %d, want 0", last)
+			}
+		})
+	}
+}
+
+// BenchmarkWAVOutput compares the allocations of buffering the whole WAV
+// with writing it in chunks (a minute of stereo 24-bit chords)
+func BenchmarkWAVOutput(b *testing.B) {
+	var events [][]byte
+	for i := 0; i < 120; i++ {
+		for _, n := range []byte{60, 64, 67} {
+			events = append(events, noteOn(0, n, 100))
+		}
+		events = append(events, noteOff(480, 60), noteOff(0, 64), noteOff(0, 67))
+	}
+	data := smf(0, 480, track(events...))
+	opts := Options{Channels: 2, BitsPerSample: 24}
+
+	b.Run("MIDIToWAV", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := MIDIToWAVWithOptions(bytes.NewReader(data), opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("MIDIToWAVWriter", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := MIDIToWAVWriter(ioutil.Discard, bytes.NewReader(data), opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestSMPTETiming(t *testing.T) {
+	tests := []struct {
+		name          string
+		fps           int
+		ticksPerFrame int
+		// frames per second
+		rate float64
+	}{
+		{"24 fps", 24, 40, 24},
+		{"25 fps", 25, 40, 25},
+		{"29.97 fps", 29, 80, 30000.0 / 1001},
+		{"30 fps", 30, 4, 30},
+		{"30 fps of 1 tick", 30, 1, 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ticks := uint(tt.fps * tt.ticksPerFrame)
+			// setTempo events do not change the time
+			data := smf(0, smpte(tt.fps, tt.ticksPerFrame), track(
+				tempo(0, 1000000),
+				noteOn(ticks, 69, 100), noteOff(ticks/2, 69),
+				tempo(0, 250000),
+				noteOn(ticks, 72, 100), noteOff(2*ticks, 72),
+			))
+			ticksPerSecond := tt.rate * float64(tt.ticksPerFrame)
+
+			timing, err := Timing(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Timing() error = %v", err)
+			}
+			want := TimeDivision{SMPTE: true, FramesPerSecond: tt.fps, TicksPerFrame: tt.ticksPerFrame}
+			if timing != want {
+				t.Errorf("Timing() = %+v, want %+v", timing, want)
+			}
+
+			prog := collect(t, data, Options{})
+			if len(prog) != 2 {
+				t.Fatalf("got %d notes, want 2", len(prog))
+			}
+			offsets := []float64{float64(ticks) / ticksPerSecond, float64(ticks/2+2*ticks) / ticksPerSecond}
+			durations := []float64{float64(ticks/2) / ticksPerSecond, float64(2*ticks) / ticksPerSecond}
+			for i, p := range prog {
+				if math.Abs(p.offset-offsets[i]) > 1e-9 || math.Abs(p.time-durations[i]) > 1e-9 {
+					t.Errorf("note %d at %v for %v, want at %v for %v", i, p.offset, p.time, offsets[i], durations[i])
+				}
+			}
+
+			samples, rate, err := MIDIToFloat32(bytes.NewReader(data), Options{})
+			if err != nil {
+				t.Fatalf("MIDIToFloat32() error = %v", err)
+			}
+			end := offsets[1] + durations[1]
+			if got := float64(len(samples)) / float64(rate); math.Abs(got-end) > 0.01 {
+				t.Errorf("MIDIToFloat32() rendered %v seconds, want %v", got, end)
+			}
+		})
+	}
+}
+
+func TestSMPTEBeats(t *testing.T) {
+	// 25 fps of 40 ticks are 1000 ticks per second
+	// which are 500 ticks per beat at 120 BPM
+	data := smf(0, smpte(25, 40), track(noteOn(260, 69, 100), noteOff(200, 69)))
+
+	tests := []struct {
+		name   string
+		opts   Options
+		offset float64
+	}{
+		{"unchanged", Options{}, 0.26},
+		{"quarter notes", Options{Quantize: 4}, 0.5},
+		{"eighth notes", Options{Quantize: 8}, 0.25},
+	}
+
+	for _, tt := range tests {
+		prog := collect(t, data, tt.opts)
+		if len(prog) != 1 || math.Abs(prog[0].offset-tt.offset) > 1e-9 {
+			t.Errorf("%s: got %v, want a note at %v", tt.name, prog, tt.offset)
+		}
+	}
+}
+
+func TestSMPTEInvalid(t *testing.T) {
+	tests := []struct {
+		name         string
+		timeDivision int
+		err          error
+	}{
+		{"100 fps", smpte(100, 40), ErrUnsupportedFormat},
+		{"no ticks per frame", smpte(25, 0), ErrInvalidHeader},
+	}
+
+	for _, tt := range tests {
+		data := smf(0, tt.timeDivision, track(noteOn(0, 69, 100), noteOff(40, 69)))
+		if _, err := MIDIToWAV(bytes.NewReader(data)); !errors.Is(err, tt.err) {
+			t.Errorf("%s: MIDIToWAV() error = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestSampleLayout(t *testing.T) {
+	// the channels differ by the phases of PhaseSpread
+	data := smf(0, 480, track(noteOn(0, 69, 100), noteOff(480, 69)))
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"mono", Options{PhaseSpread: 1}},
+		{"stereo", Options{Channels: 2, PhaseSpread: 1}},
+		{"stereo in low memory", Options{Channels: 2, PhaseSpread: 1, LowMemory: true}},
+		{"3 channels", Options{Channels: 3, PhaseSpread: 1}},
+	}
+
+	for _, tt := range tests {
+		interleaved, rate, err := MIDIToFloat32(bytes.NewReader(data), tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		tt.opts.Layout = LayoutPlanar
+		planar, planarRate, err := MIDIToFloat32(bytes.NewReader(data), tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if len(planar) != len(interleaved) || planarRate != rate {
+			t.Fatalf("%s: planar has %d samples at %d Hz, want %d at %d Hz", tt.name, len(planar), planarRate, len(interleaved), rate)
+		}
+		channels := tt.opts.numChannels()
+		frames := len(planar) / int(channels)
+		for c := 0; c < int(channels); c++ {
+			for i := 0; i < frames; i++ {
+				if got, want := planar[c*frames+i], interleaved[i*int(channels)+c]; got != want {
+					t.Fatalf("%s: planar sample %d of channel %d = %v, want %v", tt.name, i, c, got, want)
+				}
+			}
+		}
+		if channels > 1 && bytes.Equal(float32Bytes(planar[:frames]), float32Bytes(planar[frames:2*frames])) {
+			t.Errorf("%s: channels 0 and 1 are the same", tt.name)
+		}
+	}
+}
+
+// float32Bytes encodes samples in little endian
+func float32Bytes(samples []float32) []byte {
+	b := make([]byte, 4*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(s))
+	}
+	return b
+}
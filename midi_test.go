@@ -0,0 +1,483 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// vlq encodes v as a variable-length quantity
+func vlq(v uint) []byte {
+	b := []byte{byte(v & 0x7f)}
+	for v >>= 7; v > 0; v >>= 7 {
+		b = append([]byte{byte(v&0x7f) | 0x80}, b...)
+	}
+	return b
+}
+
+// event encodes an event of a track after delta ticks
+func event(delta uint, data ...byte) []byte {
+	return append(vlq(delta), data...)
+}
+
+// track joins events into the data of an MTrk chunk ending with endOfTrack
+func track(events ...[]byte) []byte {
+	var data []byte
+	for _, e := range events {
+		data = append(data, e...)
+	}
+	return append(data, event(0, 0xff, 0x2f, 0x00)...)
+}
+
+// chunk encodes a chunk of the id and the data
+func chunk(id string, data []byte) []byte {
+	n := len(data)
+	b := append([]byte(id), byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	return append(b, data...)
+}
+
+// smf encodes a MIDI file of the format and the ticks per beat with tracks
+func smf(format int, ticksPerBeat int, tracks ...[]byte) []byte {
+	data := chunk("MThd", []byte{
+		0, byte(format),
+		byte(len(tracks) >> 8), byte(len(tracks)),
+		byte(ticksPerBeat >> 8), byte(ticksPerBeat),
+	})
+	for _, t := range tracks {
+		data = append(data, chunk("MTrk", t)...)
+	}
+	return data
+}
+
+// smpte encodes the time division of SMPTE frames of the frame rate
+// subdivided into ticks (passed as the ticks per beat of smf)
+func smpte(framesPerSecond int, ticksPerFrame int) int {
+	return int(uint8(-framesPerSecond))<<8 | ticksPerFrame
+}
+
+// tempo encodes a setTempo meta event after delta ticks
+func tempo(delta uint, microsecondsPerBeat int) []byte {
+	return event(delta, 0xff, 0x51, 0x03, byte(microsecondsPerBeat>>16), byte(microsecondsPerBeat>>8), byte(microsecondsPerBeat))
+}
+
+// noteOn encodes a noteOn event of channel 0 after delta ticks
+func noteOn(delta uint, note byte, velocity byte) []byte {
+	return event(delta, 0x90, note, velocity)
+}
+
+// noteOff encodes a noteOff event of channel 0 after delta ticks
+func noteOff(delta uint, note byte) []byte {
+	return event(delta, 0x80, note, 0x00)
+}
+
+func TestRunningStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		err      error
+		subTypes []string
+	}{
+		{
+			name:     "after channel event with zero velocity",
+			data:     track(noteOn(0, 60, 100), event(480, 60, 0)),
+			subTypes: []string{"noteOn", "noteOff", "endOfTrack"},
+		},
+		{
+			name:     "status repeated after meta event",
+			data:     track(noteOn(0, 60, 100), event(0, 0xff, 0x01, 0x01, 'a'), noteOff(480, 60)),
+			subTypes: []string{"noteOn", "text", "noteOff", "endOfTrack"},
+		},
+		{
+			name: "after meta event",
+			data: track(noteOn(0, 60, 100), event(0, 0xff, 0x01, 0x01, 'a'), event(480, 60, 0)),
+			err:  ErrInvalidEvent,
+		},
+		{
+			name: "after sysex event",
+			data: track(noteOn(0, 60, 100), event(0, 0xf0, 0x01, 0xf7), event(480, 60, 0)),
+			err:  ErrInvalidEvent,
+		},
+		{
+			name: "without any status",
+			data: track(event(0, 60, 100)),
+			err:  ErrInvalidEvent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := ParseTrack(tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ParseTrack() error = %v, want %v", err, tt.err)
+			}
+			if len(events) != len(tt.subTypes) {
+				t.Fatalf("ParseTrack() returned %d events, want %d", len(events), len(tt.subTypes))
+			}
+			for i, e := range events {
+				if e.SubType != tt.subTypes[i] {
+					t.Errorf("event %d is %q, want %q", i, e.SubType, tt.subTypes[i])
+				}
+			}
+
+			// the conversion fails instead of dropping the event
+			_, err = MIDIToWAV(bytes.NewReader(smf(0, 480, tt.data)))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("MIDIToWAV() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// riffChunk encodes a RIFF chunk of the id and the data padded to even bytes
+func riffChunk(id string, data []byte) []byte {
+	n := len(data)
+	b := append([]byte(id), byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	b = append(b, data...)
+	if n%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func TestRMID(t *testing.T) {
+	midi := smf(0, 480, track(noteOn(0, 60, 100), noteOff(480, 60)))
+	// a MIDI file of odd length to be padded in the RIFF file
+	odd := smf(0, 480, track(event(0, 0xff, 0x01, 0x02, 'a', 'b'), noteOn(0, 64, 100), noteOff(480, 64)))
+
+	rmid := func(chunks ...[]byte) []byte {
+		data := []byte("RMID")
+		for _, c := range chunks {
+			data = append(data, c...)
+		}
+		return riffChunk("RIFF", data)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+		err  error
+	}{
+		{name: "not wrapped", data: midi, want: midi},
+		{name: "data chunk", data: rmid(riffChunk("data", midi)), want: midi},
+		{
+			name: "after an odd chunk",
+			data: rmid(riffChunk("DISP", []byte{1, 0, 0, 0, 'x'}), riffChunk("data", odd), riffChunk("LIST", []byte("INFO"))),
+			want: odd,
+		},
+		{name: "without data chunk", data: rmid(riffChunk("LIST", []byte("INFO"))), err: ErrInvalidHeader},
+		{name: "truncated data chunk", data: rmid(riffChunk("data", midi))[:30], err: ErrTruncated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MIDIToWAV(bytes.NewReader(tt.data))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("MIDIToWAV() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			want, err := MIDIToWAV(bytes.NewReader(tt.want))
+			if err != nil {
+				t.Fatalf("MIDIToWAV() error = %v", err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Errorf("RMID converts to %d bytes different from the embedded MIDI", got.Len())
+			}
+		})
+	}
+}
+
+func TestEndOfTrackLength(t *testing.T) {
+	// notes returns the events of a note followed by more events
+	notes := func(more ...byte) []byte {
+		data := append(noteOn(0, 60, 100), noteOff(480, 60)...)
+		return append(data, more...)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		warnings int
+		subTypes []string
+	}{
+		{
+			name:     "empty endOfTrack",
+			data:     track(noteOn(0, 60, 100), noteOff(480, 60)),
+			subTypes: []string{"noteOn", "noteOff", "endOfTrack"},
+		},
+		{
+			name:     "endOfTrack with data",
+			data:     notes(event(0, 0xff, 0x2f, 0x02, 0x00, 0x00)...),
+			warnings: 1,
+			subTypes: []string{"noteOn", "noteOff", "endOfTrack"},
+		},
+		{
+			// the length is a misread byte of the next event
+			name:     "endOfTrack followed by an event",
+			data:     notes(append(event(0, 0xff, 0x2f, 0x01, 0x00), track(noteOn(0, 62, 100))...)...),
+			warnings: 1,
+			subTypes: []string{"noteOn", "noteOff", "endOfTrack", "noteOn", "endOfTrack"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, warnings, err := readTrack(tt.data, nil)
+			if err != nil {
+				t.Fatalf("readTrack() error = %v", err)
+			}
+			if len(warnings) != tt.warnings {
+				t.Fatalf("readTrack() warned %v, want %d warnings", warnings, tt.warnings)
+			}
+			for _, w := range warnings {
+				if !errors.Is(w, ErrInvalidEvent) {
+					t.Errorf("warning %v is not %v", w, ErrInvalidEvent)
+				}
+			}
+			if len(events) != len(tt.subTypes) {
+				t.Fatalf("readTrack() returned %d events, want %d", len(events), len(tt.subTypes))
+			}
+			for i, e := range events {
+				if e.subType != tt.subTypes[i] {
+					t.Errorf("event %d is %q, want %q", i, e.subType, tt.subTypes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTruncatedTrack(t *testing.T) {
+	// the following track starts with bytes that could complete the event
+	next := track(noteOn(0, 62, 100))
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{
+			name: "complete track",
+			data: track(noteOn(0, 60, 100), noteOff(480, 60)),
+		},
+		{
+			name: "noteOn without velocity",
+			data: event(0, 0x90, 0x3c),
+			err:  ErrTruncated,
+		},
+		{
+			name: "running status without velocity",
+			data: append(noteOn(0, 60, 100), event(0, 0x3c)...),
+			err:  ErrTruncated,
+		},
+		{
+			name: "meta event longer than the track",
+			data: event(0, 0xff, 0x51, 0x03, 0x07),
+			err:  ErrTruncated,
+		},
+		{
+			name: "missing delta time",
+			data: append(noteOn(0, 60, 100), 0x81),
+			err:  ErrTruncated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := smf(1, 480, tt.data, next)
+
+			stream, err := newMIDIStream(bytes.NewReader(file))
+			if err != nil {
+				t.Fatalf("newMIDIStream() error = %v", err)
+			}
+			for _, length := range []int{6, len(tt.data)} {
+				c, err := stream.readChunk()
+				if err != nil {
+					t.Fatalf("readChunk() error = %v", err)
+				}
+				if len(c.data) != length || cap(c.data) != length {
+					t.Errorf("chunk %q has length %d and capacity %d, want %d", c.id, len(c.data), cap(c.data), length)
+				}
+			}
+
+			_, err = parseMIDI(bytes.NewReader(file))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("parseMIDI() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestVendorChunks(t *testing.T) {
+	header := chunk("MThd", []byte{0, 1, 0, 2, 0x01, 0xe0})
+	first := chunk("MTrk", track(noteOn(0, 60, 100), noteOff(480, 60)))
+	second := chunk("MTrk", track(noteOn(0, 64, 100), noteOff(480, 64)))
+	vendor := []byte{0, 1, 2, 3, 0, 0}
+
+	// mislabel returns the chunk of vendor data declaring length bytes
+	mislabel := func(id string, length int) []byte {
+		return append([]byte{id[0], id[1], id[2], id[3], 0, 0, 0, byte(length)}, vendor...)
+	}
+	join := func(parts ...[]byte) []byte {
+		var data []byte
+		for _, p := range parts {
+			data = append(data, p...)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		tracks   int
+		chunks   []Chunk
+		warnings []error
+	}{
+		{
+			name:   "before the tracks",
+			data:   join(header, chunk("XFIH", vendor), first, second),
+			tracks: 2,
+			chunks: []Chunk{{ID: "XFIH", Data: vendor}},
+		},
+		{
+			name:   "between the tracks",
+			data:   join(header, first, chunk("XFIH", vendor), chunk("XFKM", nil), second),
+			tracks: 2,
+			chunks: []Chunk{{ID: "XFIH", Data: vendor}, {ID: "XFKM", Data: []byte{}}},
+		},
+		{
+			name:     "shorter than declared",
+			data:     join(header, first, mislabel("XFKM", 2), second),
+			tracks:   2,
+			chunks:   []Chunk{{ID: "XFKM", Data: vendor[:2]}},
+			warnings: []error{ErrInvalidHeader},
+		},
+		{
+			name:     "longer than the file",
+			data:     join(header, first, mislabel("XFKM", 100), second),
+			tracks:   1,
+			warnings: []error{ErrTruncated, ErrTruncated},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			midi, err := parseMIDI(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("parseMIDI() error = %v", err)
+			}
+			if len(midi.tracks) != tt.tracks {
+				t.Errorf("got %d tracks, want %d", len(midi.tracks), tt.tracks)
+			}
+			if len(midi.warnings) != len(tt.warnings) {
+				t.Fatalf("warnings = %v, want %v", midi.warnings, tt.warnings)
+			}
+			for i, w := range midi.warnings {
+				if !errors.Is(w, tt.warnings[i]) {
+					t.Errorf("warning %d = %v, want %v", i, w, tt.warnings[i])
+				}
+			}
+
+			chunks, err := ExtraChunks(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("ExtraChunks() error = %v", err)
+			}
+			if len(chunks) != len(tt.chunks) {
+				t.Fatalf("ExtraChunks() = %v, want %v", chunks, tt.chunks)
+			}
+			for i := range chunks {
+				if chunks[i].ID != tt.chunks[i].ID || !bytes.Equal(chunks[i].Data, tt.chunks[i].Data) {
+					t.Errorf("chunk %d = %v, want %v", i, chunks[i], tt.chunks[i])
+				}
+			}
+		})
+	}
+}
+
+func TestChunkLength(t *testing.T) {
+	// header returns a chunk header of id declaring length followed by data
+	header := func(id string, length uint32, data ...byte) []byte {
+		return append([]byte{id[0], id[1], id[2], id[3], byte(length >> 24), byte(length >> 16), byte(length >> 8), byte(length)}, data...)
+	}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		length int
+		err    error
+	}{
+		{"empty", header("XFIH", 0), 0, nil},
+		{"exact", header("XFIH", 3, 1, 2, 3), 3, nil},
+		{"shorter than the data", header("XFIH", 2, 1, 2, 3), 2, nil},
+		{"one byte too long", header("XFIH", 4, 1, 2, 3), 0, ErrTruncated},
+		{"sign bit", header("XFIH", 0x80000000, 1, 2, 3), 0, ErrTruncated},
+		{"largest length", header("XFIH", 0xFFFFFFFF, 1, 2, 3), 0, ErrTruncated},
+		{"cut off header", header("XFIH", 3)[:6], 0, ErrTruncated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := newMIDIStream(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("newMIDIStream() error = %v", err)
+			}
+			c, err := stream.readChunk()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("readChunk() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && len(c.data) != tt.length {
+				t.Errorf("readChunk() read %d bytes, want %d", len(c.data), tt.length)
+			}
+		})
+	}
+
+	// a track declaring the largest length
+	file := append(header("MThd", 6, 0, 0, 0, 1, 0x01, 0xe0), header("MTrk", 0xFFFFFFFF, track(noteOn(0, 60, 100))...)...)
+	if _, err := MIDIToWAV(bytes.NewReader(file)); !errors.Is(err, ErrTruncated) {
+		t.Errorf("MIDIToWAV() error = %v, want %v", err, ErrTruncated)
+	}
+}
+
+func TestVarUintLength(t *testing.T) {
+	tests := []struct {
+		data  []byte
+		value uint
+		err   error
+	}{
+		{[]byte{0x00}, 0, nil},
+		{[]byte{0x7f}, 0x7f, nil},
+		{[]byte{0x81, 0x00}, 0x80, nil},
+		{[]byte{0xff, 0xff, 0xff, 0x7f}, 0x0fffffff, nil},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0x7f}, 0, ErrInvalidEvent},
+		{[]byte{0x81}, 0, ErrTruncated},
+	}
+
+	for _, tt := range tests {
+		stream, err := newMIDIStream(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Fatalf("newMIDIStream() error = %v", err)
+		}
+		value := stream.readVarUint()
+		if !errors.Is(stream.err, tt.err) {
+			t.Errorf("readVarUint() of % x error = %v, want %v", tt.data, stream.err, tt.err)
+		}
+		if tt.err == nil && value != tt.value {
+			t.Errorf("readVarUint() of % x = %#x, want %#x", tt.data, value, tt.value)
+		}
+	}
+}
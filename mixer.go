@@ -0,0 +1,44 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+// ChannelMode decides whether the notes of a MIDI channel are rendered
+type ChannelMode int
+
+const (
+	// ChannelNormal renders the channel unless another channel is soloed
+	ChannelNormal ChannelMode = iota
+	// ChannelMuted never renders the channel
+	ChannelMuted
+	// ChannelSoloed renders the channel and silences the channels not soloed
+	ChannelSoloed
+)
+
+// audible reports whether the notes of channel are rendered with the modes
+func audible(modes map[int]ChannelMode, channel int) bool {
+	switch modes[channel] {
+	case ChannelMuted:
+		return false
+	case ChannelSoloed:
+		return true
+	}
+
+	for _, mode := range modes {
+		if mode == ChannelSoloed {
+			return false
+		}
+	}
+	return true
+}
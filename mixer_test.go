@@ -0,0 +1,54 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestChannelState(t *testing.T) {
+	// a note on each of channels 0, 1 and 2
+	data := smf(0, 480, track(
+		event(0, 0x90, 60, 100), event(0, 0x91, 62, 100), event(0, 0x92, 64, 100),
+		event(480, 0x80, 60, 0), event(0, 0x81, 62, 0), event(0, 0x82, 64, 0),
+	))
+
+	tests := []struct {
+		name     string
+		modes    map[int]ChannelMode
+		channels []int
+	}{
+		{"no modes", nil, []int{0, 1, 2}},
+		{"all normal", map[int]ChannelMode{0: ChannelNormal, 1: ChannelNormal}, []int{0, 1, 2}},
+		{"mute one", map[int]ChannelMode{1: ChannelMuted}, []int{0, 2}},
+		{"mute two", map[int]ChannelMode{0: ChannelMuted, 2: ChannelMuted}, []int{1}},
+		{"solo one", map[int]ChannelMode{2: ChannelSoloed}, []int{2}},
+		{"solo two", map[int]ChannelMode{0: ChannelSoloed, 2: ChannelSoloed}, []int{0, 2}},
+		{"solo overrides normal", map[int]ChannelMode{0: ChannelSoloed, 1: ChannelNormal}, []int{0}},
+		{"solo and mute", map[int]ChannelMode{1: ChannelSoloed, 2: ChannelMuted}, []int{1}},
+		{"solo of another channel", map[int]ChannelMode{5: ChannelSoloed}, nil},
+	}
+
+	for _, tt := range tests {
+		var channels []int
+		for _, p := range collect(t, data, Options{ChannelState: tt.modes}) {
+			channels = append(channels, p.channel)
+		}
+		if fmt.Sprint(channels) != fmt.Sprint(tt.channels) {
+			t.Errorf("%s: rendered channels %v, want %v", tt.name, channels, tt.channels)
+		}
+	}
+}
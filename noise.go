@@ -0,0 +1,128 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"math"
+	"math/bits"
+)
+
+// NoiseColor is the spectrum of the noise used for percussion
+type NoiseColor int
+
+const (
+	// NoiseWhite has equal power at every frequency
+	NoiseWhite NoiseColor = iota
+	// NoisePink has power decreasing by 3 dB per octave (1/f)
+	NoisePink
+)
+
+const (
+	// MIDI channel 10 is reserved for percussion
+	percussionChannel = 9
+
+	// time in seconds for percussion to decay by 1/e
+	percussionDecay = 0.08
+
+	// number of random sources summed for pink noise
+	pinkRows = 16
+
+	// fixed seed for reproducible noise
+	defaultNoiseSeed = 0x2545f491
+)
+
+type noiseGenerator struct {
+	color   NoiseColor
+	state   uint32
+	rows    [pinkRows]float32
+	sum     float32
+	counter uint32
+}
+
+func newNoiseGenerator(color NoiseColor, seed uint32) *noiseGenerator {
+	// xorshift must not start from zero
+	if seed == 0 {
+		seed = defaultNoiseSeed
+	}
+
+	n := &noiseGenerator{
+		color: color,
+		state: seed,
+	}
+	for i := range n.rows {
+		n.rows[i] = n.white()
+		n.sum += n.rows[i]
+	}
+
+	return n
+}
+
+// hitSeed derives the seed of the noise of a hit from the seed
+// the note number and the start frame of the hit
+// so that every hit sounds slightly different but reproducibly
+func hitSeed(seed uint32, note int, frame int) uint32 {
+	if seed == 0 {
+		seed = defaultNoiseSeed
+	}
+
+	// murmur3 finalizer mixes the bits of each value
+	mix := func(h uint32) uint32 {
+		h ^= h >> 16
+		h *= 0x85ebca6b
+		h ^= h >> 13
+		h *= 0xc2b2ae35
+		h ^= h >> 16
+		return h
+	}
+	return mix(mix(mix(seed)^uint32(note)) ^ uint32(frame))
+}
+
+// white generates uniform random value in [-1, 1) by xorshift
+func (n *noiseGenerator) white() float32 {
+	n.state ^= n.state << 13
+	n.state ^= n.state >> 17
+	n.state ^= n.state << 5
+	return float32(n.state)/(1<<31) - 1
+}
+
+// pink generates pink noise by the Voss-McCartney algorithm
+// where the k-th row is updated every 2^k samples
+func (n *noiseGenerator) pink() float32 {
+	n.counter++
+	row := bits.TrailingZeros32(n.counter)
+	if row < pinkRows {
+		value := n.white()
+		n.sum += value - n.rows[row]
+		n.rows[row] = value
+	}
+
+	return (n.sum + n.white()) / (pinkRows + 1)
+}
+
+// percussion returns a wave of decaying noise
+func (n *noiseGenerator) percussion(sampleRate uint32) func(i int) float32 {
+	decay := -1 / (percussionDecay * float64(sampleRate))
+
+	return func(i int) float32 {
+		var d float32
+		if n.color == NoisePink {
+			// compensate the lower power of summed rows
+			d = n.pink() * 3
+		} else {
+			d = n.white()
+		}
+		return d * float32(math.Exp(decay*float64(i)))
+	}
+}
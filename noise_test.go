@@ -0,0 +1,94 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNoiseSeed(t *testing.T) {
+	// hit returns the events of a drum hit on channel 10 after delta ticks
+	hit := func(delta uint, note byte) [][]byte {
+		return [][]byte{event(delta, 0x99, note, 100), event(240, 0x89, note, 0)}
+	}
+	var events [][]byte
+	events = append(events, hit(0, 36)...)
+	events = append(events, hit(240, 36)...)
+	events = append(events, hit(240, 38)...)
+	data := smf(0, 480, track(events...))
+
+	// samples of the first 0.1 seconds of each hit
+	hits := func(samples []float32, rate uint32) [][]float32 {
+		var h [][]float32
+		for _, start := range []float64{0, 0.5, 1} {
+			from := int(start * float64(rate))
+			h = append(h, samples[from:from+int(rate)/10])
+		}
+		return h
+	}
+	equal := func(a, b []float32) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"white default seed", Options{PercussionNoise: true}},
+		{"white seed 1", Options{PercussionNoise: true, NoiseSeed: 1}},
+		{"pink seed 42", Options{PercussionNoise: true, NoiseColor: NoisePink, NoiseSeed: 42}},
+	}
+
+	outputs := make([][]float32, len(tests))
+	for i, tt := range tests {
+		first, err := MIDIToWAVWithOptions(bytes.NewReader(data), tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		second, err := MIDIToWAVWithOptions(bytes.NewReader(data), tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !bytes.Equal(first.Bytes(), second.Bytes()) {
+			t.Errorf("%s: two renders differ", tt.name)
+		}
+
+		samples, rate, err := MIDIToFloat32(bytes.NewReader(data), tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		h := hits(samples, rate)
+		if equal(h[0], h[1]) {
+			t.Errorf("%s: two hits of the same note sound the same", tt.name)
+		}
+		if equal(h[1], h[2]) {
+			t.Errorf("%s: hits of different notes sound the same", tt.name)
+		}
+		outputs[i] = samples
+	}
+
+	if equal(outputs[0], outputs[1]) {
+		t.Errorf("NoiseSeed 1 renders the same noise as the default seed")
+	}
+}
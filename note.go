@@ -0,0 +1,116 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// noteNamePattern matches occurrence of A through G
+// followed by an optional sharp or flat
+// followed by positive or negative integer (e.g. "C#4" or "Db-1")
+var noteNamePattern = regexp.MustCompile(`^([A-G])([#b]?)(-?\d+)$`)
+
+var (
+	// naturalTones are the semitones of the natural notes above C
+	naturalTones = map[string]int{
+		"C": 0, "D": 2, "E": 4, "F": 5, "G": 7, "A": 9, "B": 11,
+	}
+	// sharpNames are the names of the semitones of an octave using sharps
+	sharpNames = []string{
+		"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B",
+	}
+)
+
+// OctaveConvention decides the octave numbers of note names
+type OctaveConvention int
+
+const (
+	// MiddleC4 names middle C (MIDI note 60) "C4" and MIDI note 0 "C-1"
+	// as scientific pitch notation (the default)
+	MiddleC4 OctaveConvention = iota
+	// MiddleC3 names middle C (MIDI note 60) "C3" and MIDI note 0 "C-2"
+	// (e.g. as some synthesizers and DAWs do)
+	MiddleC3
+)
+
+// middleOctave returns the octave number of middle C
+func (c OctaveConvention) middleOctave() int {
+	if c == MiddleC3 {
+		return 3
+	}
+	return 4
+}
+
+// NoteNameToMIDI converts note name in scientific pitch notation
+// (letter, optional sharp or flat and octave e.g. "C4", "F#2" or "Db-1")
+// into MIDI note number where C-1 is 0, middle C (C4) is 60 and G9 is 127.
+// Unlike the notes of Synth.WriteNote the accidental precedes the octave.
+func NoteNameToMIDI(name string) (int, error) {
+	return MiddleC4.NoteNameToMIDI(name)
+}
+
+// MIDIToNoteName converts MIDI note number into note name
+// in scientific pitch notation using sharps for accidentals (e.g. 61 is "C#4")
+func MIDIToNoteName(n int) (string, error) {
+	return MiddleC4.MIDIToNoteName(n)
+}
+
+// NoteNameToMIDI converts note name in the same way as NoteNameToMIDI
+// numbering the octaves by the convention (e.g. "C3" is 60 by MiddleC3)
+func (c OctaveConvention) NoteNameToMIDI(name string) (int, error) {
+	s := noteNamePattern.FindStringSubmatch(name)
+	if s == nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidNote, name)
+	}
+
+	octave, err := strconv.Atoi(s[3])
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid octave in %q", ErrInvalidNote, name)
+	}
+
+	n := naturalTones[s[1]]
+	switch s[2] {
+	case "#":
+		n++
+	case "b":
+		n--
+	}
+	// compared before adding the octave so that it cannot overflow
+	// (MIDI notes span 5 octaves below and 5 octaves above middle C)
+	octave -= c.middleOctave() - 5
+	if octave < 0 || octave > 10 {
+		return 0, fmt.Errorf("%w: %q is out of MIDI range", ErrInvalidNote, name)
+	}
+	n += octave * 12
+
+	if n < minNoteNumber || n > maxNoteNumber {
+		return 0, fmt.Errorf("%w: %q is out of MIDI range", ErrInvalidNote, name)
+	}
+
+	return n, nil
+}
+
+// MIDIToNoteName converts MIDI note number into note name in the same way as MIDIToNoteName
+// numbering the octaves by the convention (e.g. 61 is "C#3" by MiddleC3)
+func (c OctaveConvention) MIDIToNoteName(n int) (string, error) {
+	if n < minNoteNumber || n > maxNoteNumber {
+		return "", fmt.Errorf("%w: note number %d is out of MIDI range", ErrInvalidNote, n)
+	}
+
+	return fmt.Sprintf("%s%d", sharpNames[n%12], n/12+c.middleOctave()-5), nil
+}
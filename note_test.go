@@ -0,0 +1,135 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNoteNames(t *testing.T) {
+	tests := []struct {
+		name   string
+		number int
+	}{
+		{"C-1", 0},
+		{"C#-1", 1},
+		{"B-1", 11},
+		{"C0", 12},
+		{"A0", 21},
+		{"C4", 60},
+		{"A4", 69},
+		{"C#5", 73},
+		{"G9", 127},
+	}
+
+	for _, tt := range tests {
+		if got, err := NoteNameToMIDI(tt.name); err != nil || got != tt.number {
+			t.Errorf("NoteNameToMIDI(%q) = %d, %v, want %d", tt.name, got, err, tt.number)
+		}
+		if got, err := MIDIToNoteName(tt.number); err != nil || got != tt.name {
+			t.Errorf("MIDIToNoteName(%d) = %q, %v, want %q", tt.number, got, err, tt.name)
+		}
+	}
+}
+
+func TestNoteNameAccidentals(t *testing.T) {
+	tests := []struct {
+		name   string
+		number int
+	}{
+		{"Db4", 61},
+		{"D#4", 63},
+		{"Eb4", 63},
+		{"B#3", 60},
+		{"Cb4", 59},
+		{"Fb-1", 4},
+		{"Gb9", 126},
+	}
+
+	for _, tt := range tests {
+		if got, err := NoteNameToMIDI(tt.name); err != nil || got != tt.number {
+			t.Errorf("NoteNameToMIDI(%q) = %d, %v, want %d", tt.name, got, err, tt.number)
+		}
+	}
+}
+
+func TestNoteNameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		convention OctaveConvention
+		// names of MIDI notes 0, 60 and 127
+		lowest, middleC, highest string
+	}{
+		{"C4 is 60", MiddleC4, "C-1", "C4", "G9"},
+		{"C3 is 60", MiddleC3, "C-2", "C3", "G8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for n, want := range map[int]string{0: tt.lowest, 60: tt.middleC, 127: tt.highest} {
+				if got, err := tt.convention.MIDIToNoteName(n); err != nil || got != want {
+					t.Errorf("MIDIToNoteName(%d) = %q, %v, want %q", n, got, err, want)
+				}
+			}
+
+			for n := minNoteNumber; n <= maxNoteNumber; n++ {
+				name, err := tt.convention.MIDIToNoteName(n)
+				if err != nil {
+					t.Fatalf("MIDIToNoteName(%d) error = %v", n, err)
+				}
+				if got, err := tt.convention.NoteNameToMIDI(name); err != nil || got != n {
+					t.Errorf("NoteNameToMIDI(MIDIToNoteName(%d)) = %d, %v", n, got, err)
+				}
+			}
+		})
+	}
+
+	for n := minNoteNumber; n <= maxNoteNumber; n++ {
+		// the default convention is C4 = 60
+		name, _ := MIDIToNoteName(n)
+		if want, _ := MiddleC4.MIDIToNoteName(n); name != want {
+			t.Errorf("MIDIToNoteName(%d) = %q, want %q", n, name, want)
+		}
+
+		// conversions of Synth.WriteNote and the renderer
+		// which spell the accidental after the octave
+		note, err := noteFromSemitone(n)
+		if err != nil {
+			t.Fatalf("noteFromSemitone(%d) error = %v", n, err)
+		}
+		if got, err := semitoneFromNote(note); err != nil || got != n {
+			t.Errorf("semitoneFromNote(%q) = %d, %v, want %d", note, got, err, n)
+		}
+	}
+}
+
+func TestInvalidNoteNames(t *testing.T) {
+	for _, name := range []string{"", "H4", "C", "c4", "C4#", "C##4", "Cbb4", "C+4", "C11", "G#9", "Cb-1", "C99999999999999999999", "REST"} {
+		if _, err := NoteNameToMIDI(name); !errors.Is(err, ErrInvalidNote) {
+			t.Errorf("NoteNameToMIDI(%q) error = %v, want ErrInvalidNote", name, err)
+		}
+	}
+	for _, name := range []string{"C-3", "G#8", "A9"} {
+		if _, err := MiddleC3.NoteNameToMIDI(name); !errors.Is(err, ErrInvalidNote) {
+			t.Errorf("MiddleC3.NoteNameToMIDI(%q) error = %v, want ErrInvalidNote", name, err)
+		}
+	}
+	for _, n := range []int{-1, 128} {
+		if _, err := MIDIToNoteName(n); !errors.Is(err, ErrInvalidNote) {
+			t.Errorf("MIDIToNoteName(%d) error = %v, want ErrInvalidNote", n, err)
+		}
+	}
+}
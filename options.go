@@ -0,0 +1,432 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Options configures the conversion from MIDI into WAV.
+// The zero value renders with the default settings.
+type Options struct {
+	// DisableNormalization renders the raw sum of the notes
+	// clipping samples out of range
+	DisableNormalization bool
+	// Gain scales the amplitude of the notes
+	// instead of the factor estimated from their velocities
+	// or the peaks of the channels if positive
+	// (e.g. Result.Gain of another conversion)
+	Gain float32
+	// Headroom lowers the normalization target below full scale (in dB)
+	Headroom float32
+	// NormalizePerChannel scales each output channel by its own peak
+	// instead of a single factor estimated from the note velocities
+	NormalizePerChannel bool
+	// AutoGain normalizes each region of the output by its own peak
+	// changing the gain smoothly (boosting by up to 18 dB)
+	// so that sparse passages are not scaled down for a dense chord
+	AutoGain bool
+	// AutoGainWindow is the length in seconds of each region (0.5 if zero)
+	AutoGainWindow float32
+
+	// Layout is the order of the samples returned by MIDIToFloat32
+	Layout SampleLayout
+
+	// Encoder writes the output of MIDIToWAVWithOptions, MIDIToWAVWriter, Convert,
+	// Stems, Sections, ReferenceTone and AuditionNote (a WAVEncoder if nil)
+	Encoder Encoder
+
+	// GateThreshold silences each output channel where it stays below the level
+	// in dB relative to full scale (e.g. -60, off if zero)
+	GateThreshold float32
+	// GateHold is the milliseconds below GateThreshold before closing (50 if zero)
+	GateHold float32
+	// GateAttack is the milliseconds of opening the gate (1 if zero)
+	GateAttack float32
+	// GateRelease is the milliseconds of closing the gate (20 if zero)
+	GateRelease float32
+
+	// Channels is the number of output channels up to 8 (1 if zero)
+	Channels int
+	// PhaseSpread starts each note in each output channel
+	// at a random phase up to the fraction of a cycle (0 to 1)
+	// to widen the stereo image of the same notes in every channel
+	PhaseSpread float32
+	// PhaseSeed varies the phases of PhaseSpread (a fixed seed if zero)
+	PhaseSeed uint32
+	// ChannelMask assigns the output channels to speaker positions
+	// (e.g. 0x3F for 5.1) in a WAVE_FORMAT_EXTENSIBLE header
+	// which is also written for more than 2 channels with the common layout
+	ChannelMask uint32
+	// HaasDelay delays HaasChannel by the milliseconds (e.g. 5 to 20)
+	// to widen the stereo image
+	HaasDelay float32
+	// HaasChannel is the output channel delayed by HaasDelay
+	HaasChannel int
+	// DownmixMono mixes the output channels down to mono after the effects
+	DownmixMono bool
+	// DownmixMode decides how the channels are mixed down
+	DownmixMode DownmixMode
+	// DownmixCheckPhase warns if the channels cancel out on averaging
+	DownmixCheckPhase bool
+	// MidSide encodes stereo output as mid (L+R)/2 in the first channel
+	// and side (L-R)/2 in the second channel
+	MidSide bool
+
+	// Waveform is the shape of the oscillator rendering the notes
+	Waveform Waveform
+	// SquareDuty is the fraction of each cycle square waves are high
+	// (e.g. 0.125, 0.25 or 0.5, 0.5 if zero)
+	SquareDuty float32
+
+	// EqualLoudness boosts low and high notes to be perceived
+	// as loud as the middle notes (by the inverse of A-weighting up to 12 dB,
+	// included when normalizing volume)
+	EqualLoudness bool
+
+	// ImpulseResponse is a WAV convolved with the output for reverb if not empty
+	// (scaled to unit energy so that ReverbMix alone sets the level of the reverb)
+	ImpulseResponse []byte
+	// ReverbMix is the level of the reverb mixed with the dry output (0 to 1, 0.5 if zero)
+	ReverbMix float32
+	// ReverbSend is the level of the notes of each MIDI channel fed to the reverb
+	// (0 to 1, 1 for channels without a level) before AutoGain, GateThreshold
+	// and LoopCrossfade which apply to the dry output
+	ReverbSend map[int]float32
+
+	// PercussionNoise renders the notes of MIDI channel 10 as decaying noise
+	PercussionNoise bool
+	// NoiseColor is the spectrum of the noise for percussion
+	NoiseColor NoiseColor
+	// NoiseSeed varies the noise of all hits (a fixed seed if zero)
+	// while the same input always renders the same output
+	NoiseSeed uint32
+
+	// FadeCurve is the shape of the fade at the start and the end of each note
+	FadeCurve FadeCurve
+
+	// SampleRate is the sample rate of the output up to 768000 (44100 if zero)
+	// to which the notes rendered at 44100 Hz are resampled
+	// (low-pass filtered first when downsampling)
+	SampleRate int
+	// Interpolation is the quality of resampling to SampleRate
+	Interpolation Interpolation
+
+	// BitsPerSample is the resolution of the output samples (8, 16, 24 or 32, 16 if zero)
+	BitsPerSample int
+	// FloatSamples writes 32-bit floating point samples which are not clipped
+	// instead of integers of BitsPerSample
+	// (with a channel mask only for more than 2 channels)
+	FloatSamples bool
+
+	// Oversample renders at the multiple of the sample rate up to 16
+	// and decimates back through a low-pass filter to reduce aliasing (1 if zero)
+	Oversample int
+
+	// SelectSequence renders only the tracks of SequenceNumber
+	// given by sequenceNumber events (or by the location of the track by default)
+	SelectSequence bool
+	// SequenceNumber is the sequence rendered if SelectSequence is set
+	SequenceNumber int
+
+	// TempoTrack is the index of the track holding the setTempo events
+	// (-1 to scan all tracks)
+	TempoTrack int
+
+	// Metronome overlays a click at each beat (accented on downbeats)
+	Metronome bool
+	// MetronomeVolume is the normalized amplitude of the clicks (0.5 if zero)
+	MetronomeVolume float32
+
+	// Loops plays the region between the loopStart and loopEnd markers
+	// (or the whole MIDI if there are no such markers) the number of times
+	Loops int
+	// LoopCrossfade mixes the end of each repetition of Loops
+	// into the start of the next with constant power over the milliseconds
+	// to prevent a click at the seam
+	LoopCrossfade float32
+
+	// TrimSilence starts the output at the first note
+	// (before ClipStart and ClipEnd are applied)
+	TrimSilence bool
+	// ClipStart is the time in seconds where rendering starts
+	ClipStart float32
+	// ClipEnd is the time in seconds where rendering ends (the end of MIDI if zero)
+	ClipEnd float32
+
+	// Transpose shifts every note by the number of semitones
+	Transpose int
+	// ChannelTranspose shifts the notes of each MIDI channel by the semitones
+	// in addition to Transpose
+	ChannelTranspose map[int]int
+	// TransposePolicy handles notes transposed outside of the MIDI range
+	TransposePolicy TransposePolicy
+
+	// ChannelState mutes or solos each MIDI channel
+	// while the silenced notes are still counted for normalizing
+	ChannelState map[int]ChannelMode
+
+	// MinNote and MaxNote render only the notes within the MIDI note numbers
+	// after transposing (e.g. MaxNote 48 for a bass line below C3,
+	// unlimited if zero so that note 0 alone is selected by no range)
+	// while the others are still counted for normalizing
+	MinNote int
+	MaxNote int
+
+	// Detune shifts the notes of each MIDI channel by the cents
+	Detune map[int]float32
+	// PitchShiftCents shifts all notes by the cents in addition to Detune
+	// (e.g. -30 to match a recording tuned 30 cents flat)
+	PitchShiftCents float32
+
+	// Swing delays the off-beat notes half way through each beat
+	// of the time signature (e.g. eighth notes of 4/4 or sixteenth notes of 6/8)
+	// by the fraction of a half beat (0 to 1, straight if zero, 1/3 for triplet feel)
+	Swing float32
+
+	// Quantize snaps the notes to a grid of the note value
+	// (e.g. 16 for sixteenth notes, 12 for eighth note triplets, off if zero)
+	Quantize int
+	// QuantizeStrength moves the notes by the fraction of the way
+	// to the grid (0 to 1, fully if zero)
+	QuantizeStrength float32
+	// QuantizeDurations snaps the durations of the notes to the grid as well
+	QuantizeDurations bool
+
+	// Expression renders the changes of channel volume, expression
+	// and aftertouch during each note (from any track of the channel)
+	// up to the level of its velocity
+	Expression bool
+	// PitchBend decides how pitchBend events bend the sounding notes
+	PitchBend PitchBend
+	// PitchBendRange is the bend in semitones of a full pitchBend event (2 if zero)
+	PitchBendRange float32
+
+	// HumanizeTiming delays the start of each note by a random time
+	// of at most the milliseconds (e.g. 10 to loosen quantized MIDI)
+	HumanizeTiming float32
+	// HumanizeVelocity changes the velocity of each note by a random amount
+	// of at most the value up or down (within 1 to 127)
+	HumanizeVelocity int
+	// HumanizeSeed varies the delays of HumanizeTiming
+	// and the changes of HumanizeVelocity (a fixed seed if zero)
+	// while the same input always renders the same output
+	HumanizeSeed uint32
+
+	// Staccato scales the rendered duration of each note (0 to 1, legato if zero)
+	Staccato float32
+
+	// Retrigger decides how a noteOn event for a sounding note is handled
+	Retrigger RetriggerPolicy
+
+	// MinVelocity skips notes with lower velocity
+	MinVelocity int
+	// FixedVelocity renders every note at the velocity (1 to 127)
+	// instead of its own (which is still compared with MinVelocity)
+	FixedVelocity int
+
+	// MaxTracks fails the conversion if the MIDI declares more tracks (unlimited if zero)
+	MaxTracks int
+	// MaxOutputBytes fails the conversion before rendering
+	// if the WAV would be larger (unlimited if zero)
+	MaxOutputBytes int
+	// LowMemory holds the samples in memory mapped temporary files
+	// that the operating system can page out to disk instead of in memory
+	// (e.g. for renders of hours, best written by MIDIToWAVWriter
+	// as the other functions still return the whole WAV in memory)
+	LowMemory bool
+	// TempDir is the directory of the files of LowMemory
+	// (the default directory for temporary files if empty)
+	TempDir string
+
+	// ValidateHeader checks the consistency of the WAV header before returning
+	// (the header written by the default WAVEncoder)
+	ValidateHeader bool
+
+	// DebugWriter receives the rendered notes as JSON if not nil
+	DebugWriter io.Writer
+
+	// BroadcastExtension adds a bext chunk to the WAV if not nil
+	BroadcastExtension *BroadcastExtension
+	// DisableCopyright leaves out the copyrightNotice of the MIDI
+	// which is otherwise written to the ICOP field of a LIST INFO chunk
+	DisableCopyright bool
+
+	// Envelope makes Convert compute the RMS envelope of the output
+	Envelope bool
+	// EnvelopeInterval is the length in seconds of each envelope value (0.01 if zero)
+	EnvelopeInterval float32
+
+	// Warn is called with each problem that does not stop the conversion if not nil
+	Warn func(err error)
+
+	// stemChannel renders only the notes of the MIDI channel if not nil
+	stemChannel *int
+}
+
+// limits of the options beyond which the output is not rendered
+const (
+	maxChannels   = 8
+	maxOversample = 16
+	maxSampleRate = 768000
+)
+
+// validate checks that the options are within their limits
+func (o *Options) validate() error {
+	if o.Channels < 0 || o.Channels > maxChannels {
+		return fmt.Errorf("%w: %d channels are outside of 1 to %d", ErrInvalidOption, o.Channels, maxChannels)
+	}
+	if o.Oversample < 0 || o.Oversample > maxOversample {
+		return fmt.Errorf("%w: oversample %d is outside of 1 to %d", ErrInvalidOption, o.Oversample, maxOversample)
+	}
+	if o.SampleRate < 0 || o.SampleRate > maxSampleRate {
+		return fmt.Errorf("%w: sample rate %d is outside of 1 to %d", ErrInvalidOption, o.SampleRate, maxSampleRate)
+	}
+	return nil
+}
+
+// sampleRate returns the sample rate of the output
+func (o *Options) sampleRate() uint32 {
+	if o.SampleRate <= 0 {
+		return 44100
+	}
+	return uint32(o.SampleRate)
+}
+
+// headroomGain converts Headroom into a linear gain factor
+func (o *Options) headroomGain() float32 {
+	if o.Headroom <= 0 {
+		return 1
+	}
+	return float32(math.Pow(10, -float64(o.Headroom)/20))
+}
+
+// articulation returns the scale of rendered note durations
+func (o *Options) articulation() float32 {
+	if o.Staccato <= 0 || o.Staccato > 1 {
+		return 1
+	}
+	return o.Staccato
+}
+
+// quantizeGrid returns the ticks between the grid points of Quantize
+// or zero if off
+func (o *Options) quantizeGrid(ticksPerBeat int) float64 {
+	if o.Quantize <= 0 {
+		return 0
+	}
+	// a beat of the time division is a quarter note
+	// (the grid is not a whole number of ticks for some tuplets)
+	return math.Max(float64(ticksPerBeat*4)/float64(o.Quantize), 1)
+}
+
+// autoGainWindow returns the length in seconds of each region of AutoGain
+func (o *Options) autoGainWindow() float32 {
+	if o.AutoGainWindow <= 0 {
+		return 0.5
+	}
+	return o.AutoGainWindow
+}
+
+// inRange reports whether the note number is within MinNote and MaxNote
+func (o *Options) inRange(pitch int) bool {
+	return pitch >= o.MinNote && (o.MaxNote <= 0 || pitch <= o.MaxNote)
+}
+
+// velocity returns the rendered velocity of a note of velocity v
+func (o *Options) velocity(v int) int {
+	if o.FixedVelocity <= 0 {
+		return v
+	}
+	return minInt(o.FixedVelocity, 127)
+}
+
+// gate returns the threshold (normalized amplitude) and the times in seconds
+// of the noise gate
+func (o *Options) gate() (threshold float32, hold, attack, release float64) {
+	// milliseconds returns ms in seconds or fallback if not positive
+	milliseconds := func(ms float32, fallback float64) float64 {
+		if ms <= 0 {
+			return fallback / 1000
+		}
+		return float64(ms) / 1000
+	}
+
+	threshold = float32(math.Pow(10, float64(o.GateThreshold)/20))
+	return threshold, milliseconds(o.GateHold, 50), milliseconds(o.GateAttack, 1), milliseconds(o.GateRelease, 20)
+}
+
+// pitchBendRange returns the bend in semitones of a full pitchBend event
+func (o *Options) pitchBendRange() float32 {
+	if o.PitchBendRange <= 0 {
+		return defaultPitchBendRange
+	}
+	return o.PitchBendRange
+}
+
+// warn reports problems that do not stop the conversion
+func (o *Options) warn(warnings ...error) {
+	if o.Warn == nil {
+		return
+	}
+	for _, warning := range warnings {
+		o.Warn(warning)
+	}
+}
+
+// numChannels returns the number of output channels
+func (o *Options) numChannels() uint16 {
+	if o.Channels <= 0 {
+		return 1
+	}
+	return uint16(o.Channels)
+}
+
+// squareDuty returns the duty cycle of square waves
+func (o *Options) squareDuty() float64 {
+	if o.SquareDuty <= 0 || o.SquareDuty >= 1 {
+		return defaultSquareDuty
+	}
+	return float64(o.SquareDuty)
+}
+
+// reverbMix returns the level of the reverb
+func (o *Options) reverbMix() float32 {
+	if o.ReverbMix <= 0 || o.ReverbMix > 1 {
+		return 0.5
+	}
+	return o.ReverbMix
+}
+
+// bitsPerSample returns the resolution of the output samples
+func (o *Options) bitsPerSample() int {
+	if o.FloatSamples {
+		return 32
+	}
+	if o.BitsPerSample == 0 {
+		return 16
+	}
+	return o.BitsPerSample
+}
+
+// envelopeInterval returns the length in seconds of each envelope value
+func (o *Options) envelopeInterval() float32 {
+	if o.EnvelopeInterval <= 0 {
+		return 0.01
+	}
+	return o.EnvelopeInterval
+}
@@ -0,0 +1,262 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestOptionLimits(t *testing.T) {
+	data := smf(0, 480, track(noteOn(0, 69, 100), noteOff(480, 69)))
+
+	tests := []struct {
+		name     string
+		opts     Options
+		err      error
+		channels uint16
+	}{
+		{name: "default channels", opts: Options{}, channels: 1},
+		{name: "8 channels", opts: Options{Channels: 8}, channels: 8},
+		{name: "9 channels", opts: Options{Channels: 9}, err: ErrInvalidOption},
+		{name: "negative channels", opts: Options{Channels: -1}, err: ErrInvalidOption},
+		{name: "oversample 16", opts: Options{Oversample: 16}, channels: 1},
+		{name: "oversample 17", opts: Options{Oversample: 17}, err: ErrInvalidOption},
+		{name: "negative oversample", opts: Options{Oversample: -2}, err: ErrInvalidOption},
+		{name: "sample rate 768000", opts: Options{SampleRate: 768000}, channels: 1},
+		{name: "sample rate 768001", opts: Options{SampleRate: 768001}, err: ErrInvalidOption},
+		{name: "negative sample rate", opts: Options{SampleRate: -44100, MaxOutputBytes: 1 << 20}, err: ErrInvalidOption},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := MIDIToWAVWithOptions(bytes.NewReader(data), tt.opts)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("MIDIToWAVWithOptions() error = %v, want %v", err, tt.err)
+			}
+			if _, toneErr := ReferenceTone(440, 0.1, 1, tt.opts); !errors.Is(toneErr, tt.err) {
+				t.Errorf("ReferenceTone() error = %v, want %v", toneErr, tt.err)
+			}
+			if _, auditionErr := AuditionNote(69, 100, 0.1, tt.opts); !errors.Is(auditionErr, tt.err) {
+				t.Errorf("AuditionNote() error = %v, want %v", auditionErr, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if n := binary.LittleEndian.Uint16(buf.Bytes()[22:24]); n != tt.channels {
+				t.Errorf("header declares %d channels, want %d", n, tt.channels)
+			}
+		})
+	}
+}
+
+func TestMaxOutputBytesSampleRate(t *testing.T) {
+	// 0.5 seconds of 16-bit mono take 44100 bytes at 44100 Hz
+	data := smf(0, 480, track(noteOn(0, 69, 100), noteOff(480, 69)))
+
+	tests := []struct {
+		sampleRate int
+		err        error
+	}{
+		{0, nil},
+		{22050, nil},
+		{48000, nil},
+		{96000, ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		_, err := MIDIToWAVWithOptions(bytes.NewReader(data), Options{SampleRate: tt.sampleRate, MaxOutputBytes: 50000})
+		if !errors.Is(err, tt.err) {
+			t.Errorf("SampleRate %d: MIDIToWAVWithOptions() error = %v, want %v", tt.sampleRate, err, tt.err)
+		}
+	}
+}
+
+func TestMaxOutputBytesBeforeExpansion(t *testing.T) {
+	// 0.5 seconds of 16-bit mono take 44100 bytes at 44100 Hz
+	short := smf(0, 480, track(noteOn(0, 69, 100), noteOff(480, 69)))
+	// a note held for days would have hundreds of thousands of clicks
+	long := smf(0, 480, track(noteOn(0, 69, 100), noteOff(0x0fffffff, 69)))
+
+	tests := []struct {
+		name string
+		data []byte
+		opts Options
+		err  error
+	}{
+		{"two loops", short, Options{Loops: 2, MaxOutputBytes: 100000}, nil},
+		{"four loops", short, Options{Loops: 4, MaxOutputBytes: 100000}, ErrTooLarge},
+		{"clipped loops", short, Options{Loops: 4, ClipEnd: 1, MaxOutputBytes: 100000}, nil},
+		{"metronome", long, Options{Metronome: true, MaxOutputBytes: 1 << 20}, ErrTooLarge},
+		{"clipped metronome", long, Options{Metronome: true, ClipEnd: 1, MaxOutputBytes: 1 << 20}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := MIDIToWAVWithOptions(bytes.NewReader(tt.data), tt.opts)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("MIDIToWAVWithOptions() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNoteRange(t *testing.T) {
+	var events [][]byte
+	for _, n := range []byte{0, 36, 48, 60, 72, 127} {
+		events = append(events, noteOn(0, n, 100), noteOff(480, n))
+	}
+	data := smf(0, 480, track(events...))
+
+	tests := []struct {
+		name  string
+		opts  Options
+		notes []string
+	}{
+		{"unlimited", Options{}, []string{"C-1", "C2", "C3", "C4", "C5", "G9"}},
+		{"bass line", Options{MaxNote: 48}, []string{"C-1", "C2", "C3"}},
+		{"from middle C", Options{MinNote: 60}, []string{"C4", "C5", "G9"}},
+		{"both ends", Options{MinNote: 36, MaxNote: 60}, []string{"C2", "C3", "C4"}},
+		{"single note", Options{MinNote: 72, MaxNote: 72}, []string{"C5"}},
+		{"empty range", Options{MinNote: 61, MaxNote: 71}, nil},
+		{"after transposing", Options{MaxNote: 48, Transpose: 12}, []string{"C0", "C3"}},
+	}
+
+	for _, tt := range tests {
+		var notes []string
+		for _, p := range collect(t, data, tt.opts) {
+			notes = append(notes, p.note)
+		}
+		if fmt.Sprint(notes) != fmt.Sprint(tt.notes) {
+			t.Errorf("%s: got notes %v, want %v", tt.name, notes, tt.notes)
+		}
+	}
+
+	// the notes outside of the range are still counted for normalizing
+	midi, err := parseMIDI(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	timer, err := midi.timer(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, noteEvents, _, err := collectNotes(midi, timer, Options{MinNote: 61, MaxNote: 71})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(noteEvents) != 12 {
+		t.Errorf("got %d note events, want 12", len(noteEvents))
+	}
+}
+
+func TestFixedVelocity(t *testing.T) {
+	velocities := []byte{20, 64, 127}
+	var events [][]byte
+	for _, v := range velocities {
+		events = append(events, noteOn(0, 69, v), noteOff(480, 69))
+	}
+	data := smf(0, 480, track(events...))
+
+	tests := []struct {
+		name       string
+		opts       Options
+		velocities []int
+	}{
+		{"original", Options{}, []int{20, 64, 127}},
+		{"fixed", Options{FixedVelocity: 100}, []int{100, 100, 100}},
+		{"above 127", Options{FixedVelocity: 200}, []int{127, 127, 127}},
+		{"after MinVelocity", Options{FixedVelocity: 100, MinVelocity: 30}, []int{100, 100}},
+	}
+
+	for _, tt := range tests {
+		var got []int
+		for _, p := range collect(t, data, tt.opts) {
+			got = append(got, int(p.amplitude*128))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.velocities) {
+			t.Errorf("%s: got velocities %v, want %v", tt.name, got, tt.velocities)
+		}
+	}
+
+	// every note renders at the same peak
+	samples, rate, err := MIDIToFloat32(bytes.NewReader(data), Options{FixedVelocity: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var peaks []float32
+	for i := range velocities {
+		var peak float32
+		for _, s := range samples[i*int(rate)/2 : (i+1)*int(rate)/2] {
+			if s > peak {
+				peak = s
+			}
+		}
+		peaks = append(peaks, peak)
+	}
+	for i, peak := range peaks {
+		if peak < 0.5 || peak-peaks[0] > 1e-3 || peaks[0]-peak > 1e-3 {
+			t.Errorf("note %d peaks at %v, want %v as the others", i, peak, peaks[0])
+		}
+	}
+}
+
+func TestMaxTracks(t *testing.T) {
+	// many returns a file declaring count tracks followed by the first two tracks
+	many := func(count int) []byte {
+		data := chunk("MThd", []byte{0, 1, byte(count >> 8), byte(count), 0x01, 0xe0})
+		data = append(data, chunk("MTrk", track(noteOn(0, 60, 100), noteOff(480, 60)))...)
+		return append(data, chunk("MTrk", track(noteOn(0, 64, 100), noteOff(480, 64)))...)
+	}
+
+	tests := []struct {
+		name      string
+		count     int
+		maxTracks int
+		err       error
+	}{
+		{"unlimited", 60000, 0, nil},
+		{"within the limit", 2, 16, nil},
+		{"at the limit", 16, 16, nil},
+		{"above the limit", 17, 16, ErrTooLarge},
+		{"thousands of tracks", 60000, 256, ErrTooLarge},
+	}
+
+	convert := map[string]func(data []byte, opts Options) error{
+		"MIDIToWAVWithOptions": func(data []byte, opts Options) error {
+			_, err := MIDIToWAVWithOptions(bytes.NewReader(data), opts)
+			return err
+		},
+		"Stems": func(data []byte, opts Options) error {
+			_, err := Stems(bytes.NewReader(data), opts)
+			return err
+		},
+		"Sections": func(data []byte, opts Options) error {
+			_, err := Sections(bytes.NewReader(data), opts)
+			return err
+		},
+	}
+
+	for _, tt := range tests {
+		for name, f := range convert {
+			if err := f(many(tt.count), Options{MaxTracks: tt.maxTracks}); !errors.Is(err, tt.err) {
+				t.Errorf("%s: %s() error = %v, want %v", tt.name, name, err, tt.err)
+			}
+		}
+	}
+}
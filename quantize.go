@@ -0,0 +1,33 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "math"
+
+// quantize moves tick by strength (0 to 1, fully if zero)
+// of the way to the nearest grid point (a multiple of grid in ticks)
+// where each grid point is rounded to a tick on its own
+// so that tuplets not dividing the beat into whole ticks stay even
+func quantize(tick int, grid float64, strength float32) int {
+	if grid <= 0 {
+		return tick
+	}
+	if strength <= 0 || strength > 1 {
+		strength = 1
+	}
+
+	nearest := int(math.Round(math.Round(float64(tick)/grid) * grid))
+	return tick + int(math.Round(float64(nearest-tick)*float64(strength)))
+}
@@ -0,0 +1,171 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuantize(t *testing.T) {
+	tests := []struct {
+		tick     int
+		grid     float64
+		strength float32
+		want     int
+	}{
+		{130, 120, 1, 120},
+		{170, 120, 1, 120},
+		{190, 120, 1, 240},
+		{60, 120, 1, 120},
+		{240, 120, 1, 240},
+		{130, 120, 0.5, 125},
+		{190, 120, 0.5, 215},
+		{130, 120, 0, 120},
+		{130, 0, 1, 130},
+	}
+
+	for _, tt := range tests {
+		if got := quantize(tt.tick, tt.grid, tt.strength); got != tt.want {
+			t.Errorf("quantize(%d, %v, %v) = %d, want %d", tt.tick, tt.grid, tt.strength, got, tt.want)
+		}
+	}
+}
+
+func TestQuantizeNotes(t *testing.T) {
+	// sixteenth notes at 480 ticks per beat are 120 ticks (62.5 ms at 120 bpm)
+	data := smf(0, 480, track(
+		noteOn(130, 60, 100), noteOff(120, 60),
+		noteOn(120, 62, 100), noteOff(100, 62),
+	))
+
+	tests := []struct {
+		name      string
+		opts      Options
+		offsets   []float64
+		durations []float64
+	}{
+		{
+			name:      "off",
+			opts:      Options{},
+			offsets:   []float64{130.0 / 960, 370.0 / 960},
+			durations: []float64{120.0 / 960, 100.0 / 960},
+		},
+		{
+			name:      "sixteenth notes",
+			opts:      Options{Quantize: 16},
+			offsets:   []float64{120.0 / 960, 360.0 / 960},
+			durations: []float64{120.0 / 960, 100.0 / 960},
+		},
+		{
+			name:      "half strength",
+			opts:      Options{Quantize: 16, QuantizeStrength: 0.5},
+			offsets:   []float64{125.0 / 960, 365.0 / 960},
+			durations: []float64{120.0 / 960, 100.0 / 960},
+		},
+		{
+			name:      "durations",
+			opts:      Options{Quantize: 16, QuantizeDurations: true},
+			offsets:   []float64{120.0 / 960, 360.0 / 960},
+			durations: []float64{120.0 / 960, 120.0 / 960},
+		},
+		{
+			name:      "quarter notes",
+			opts:      Options{Quantize: 4},
+			offsets:   []float64{0, 480.0 / 960},
+			durations: []float64{120.0 / 960, 100.0 / 960},
+		},
+	}
+
+	for _, tt := range tests {
+		prog := collect(t, data, tt.opts)
+		if len(prog) != len(tt.offsets) {
+			t.Fatalf("%s: got %d notes, want %d", tt.name, len(prog), len(tt.offsets))
+		}
+		for i, p := range prog {
+			if math.Abs(p.offset-tt.offsets[i]) > 1e-9 {
+				t.Errorf("%s: note %d offset = %v, want %v", tt.name, i, p.offset, tt.offsets[i])
+			}
+			if math.Abs(p.time-tt.durations[i]) > 1e-9 {
+				t.Errorf("%s: note %d duration = %v, want %v", tt.name, i, p.time, tt.durations[i])
+			}
+		}
+	}
+}
+
+func TestQuantizeTriplets(t *testing.T) {
+	// eighth note triplets of 40 beats at 100 ticks per beat played a little off
+	// where the grid of 33.3 ticks is not a whole number of ticks
+	var (
+		events []byte
+		last   int
+		jitter = []int{3, -4, 2}
+		ideal  = []int{0, 33, 67}
+	)
+	for b := 0; b < 40; b++ {
+		for j := range ideal {
+			tick := b*100 + ideal[j] + jitter[j]
+			events = append(events, noteOn(uint(tick-last), byte(60+j), 100)...)
+			events = append(events, noteOff(20, byte(60+j))...)
+			last = tick + 20
+		}
+	}
+	data := smf(0, 100, track(events))
+
+	prog := collect(t, data, Options{Quantize: 12})
+	if len(prog) != 120 {
+		t.Fatalf("got %d notes, want 120", len(prog))
+	}
+	for i, p := range prog {
+		b, j := i/3, i%3
+		// a tick is 5 ms at 120 BPM
+		want := float64(b*100+ideal[j]) * 0.005
+		if samples := math.Abs(p.offset-want) * 44100; samples >= 0.5 {
+			t.Errorf("note %d of beat %d at %v seconds, want %v (%.0f samples off)", j, b, p.offset, want, samples)
+		}
+	}
+}
+
+func TestQuantizeWholeGrid(t *testing.T) {
+	// grids of whole ticks snap as to the nearest multiple rounding half up
+	tests := []struct {
+		ticksPerBeat int
+		quantize     int
+	}{
+		{480, 4},
+		{480, 16},
+		{480, 32},
+		{480, 12},
+		{96, 8},
+		{96, 24},
+		{100, 4},
+	}
+
+	for _, tt := range tests {
+		opts := Options{Quantize: tt.quantize}
+		grid := opts.quantizeGrid(tt.ticksPerBeat)
+		step := tt.ticksPerBeat * 4 / tt.quantize
+		if grid != float64(step) {
+			t.Errorf("quantizeGrid(%d) of Quantize %d = %v, want %d", tt.ticksPerBeat, tt.quantize, grid, step)
+			continue
+		}
+		for tick := 0; tick < 10*tt.ticksPerBeat; tick++ {
+			if got, want := quantize(tick, grid, 1), (tick+step/2)/step*step; got != want {
+				t.Errorf("quantize(%d) to %d ticks = %d, want %d", tick, step, got, want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "math"
+
+// number of filter taps per decimation factor on each side of the center
+const lowPassTaps = 8
+
+// Interpolation is the quality of resampling to the output sample rate
+type Interpolation int
+
+const (
+	// InterpolationLinear interpolates linearly between neighboring frames
+	InterpolationLinear Interpolation = iota
+	// InterpolationNearest takes the nearest frame (fast)
+	InterpolationNearest
+	// InterpolationSinc convolves with a Blackman-windowed sinc (best)
+	InterpolationSinc
+)
+
+// blackman returns the Blackman window at x (-1 to 1)
+func blackman(x float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	return 0.42 + 0.5*math.Cos(math.Pi*x) + 0.08*math.Cos(2*math.Pi*x)
+}
+
+// lowPassFilter designs a Blackman-windowed sinc filter
+// with cutoff frequency normalized to the sample rate
+func lowPassFilter(cutoff float64, halfLength int) []float32 {
+	length := 2*halfLength + 1
+	filter := make([]float32, length)
+
+	var sum float64
+	for i := 0; i < length; i++ {
+		x := float64(i - halfLength)
+
+		h := 2 * cutoff
+		if x != 0 {
+			h = math.Sin(2*math.Pi*cutoff*x) / (math.Pi * x)
+		}
+
+		window := 0.42 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(length-1)) +
+			0.08*math.Cos(4*math.Pi*float64(i)/float64(length-1))
+
+		filter[i] = float32(h * window)
+		sum += h * window
+	}
+
+	// unity gain at DC
+	for i := range filter {
+		filter[i] /= float32(sum)
+	}
+
+	return filter
+}
+
+// decimate low-pass filters the sound data and keeps every factor-th frame
+// dividing the sample rate by factor
+func (w *wavData) decimate(factor int) {
+	if factor <= 1 {
+		return
+	}
+
+	var (
+		numChannels = int(w.numChannels)
+		frames      = w.length / numChannels
+		outFrames   = (frames + factor - 1) / factor
+		halfLength  = lowPassTaps * factor
+		filter      = lowPassFilter(0.5/float64(factor), halfLength)
+	)
+	data, file := w.makeSamples(outFrames * numChannels)
+
+	for i := 0; i < outFrames; i++ {
+		center := i * factor
+
+		for c := 0; c < numChannels; c++ {
+			var d float32
+			for j, h := range filter {
+				k := center + j - halfLength
+				if k < 0 || k >= frames {
+					continue
+				}
+				d += h * w.data[k*numChannels+c]
+			}
+			data[i*numChannels+c] = d
+		}
+	}
+
+	w.setSamples(data, file)
+	w.length = len(data)
+	w.sampleRate /= uint32(factor)
+	w.pointer /= uint(factor)
+	w.updateSizes()
+}
+
+// lowPass filters the sound data with a Blackman-windowed sinc
+// of cutoff frequency normalized to the sample rate
+func (w *wavData) lowPass(cutoff float64, halfLength int) {
+	var (
+		numChannels = int(w.numChannels)
+		frames      = w.length / numChannels
+		filter      = lowPassFilter(cutoff, halfLength)
+	)
+	data, file := w.makeSamples(w.length)
+
+	for i := 0; i < frames; i++ {
+		for c := 0; c < numChannels; c++ {
+			var d float32
+			for j, h := range filter {
+				k := i + j - halfLength
+				if k < 0 || k >= frames {
+					continue
+				}
+				d += h * w.data[k*numChannels+c]
+			}
+			data[i*numChannels+c] = d
+		}
+	}
+
+	w.setSamples(data, file)
+}
+
+// resample converts the sound data to sampleRate
+// interpolating between frames with the given quality
+func (w *wavData) resample(sampleRate uint32, interpolation Interpolation) {
+	if sampleRate == 0 || sampleRate == w.sampleRate {
+		return
+	}
+
+	var (
+		numChannels = int(w.numChannels)
+		frames      = w.length / numChannels
+		// input frames per output frame
+		ratio     = float64(w.sampleRate) / float64(sampleRate)
+		outFrames = int(float64(frames) / ratio)
+	)
+
+	// interpolating between frames does not remove the frequencies
+	// above the output Nyquist frequency which would alias when downsampling
+	if ratio > 1 && interpolation != InterpolationSinc {
+		w.lowPass(0.5/ratio, lowPassTaps*int(math.Ceil(ratio)))
+	}
+
+	data, file := w.makeSamples(outFrames * numChannels)
+
+	// frame returns the sample of channel c at input frame k (zero outside)
+	frame := func(k, c int) float32 {
+		if k < 0 || k >= frames {
+			return 0
+		}
+		return w.data[k*numChannels+c]
+	}
+
+	// the cutoff is lowered below the output Nyquist frequency when downsampling
+	cutoff := 0.5 * math.Min(1, 1/ratio)
+	halfWidth := float64(lowPassTaps) * math.Max(1, ratio)
+
+	for i := 0; i < outFrames; i++ {
+		pos := float64(i) * ratio
+		k := int(pos)
+		fraction := float32(pos - float64(k))
+
+		for c := 0; c < numChannels; c++ {
+			var d float32
+			switch interpolation {
+			case InterpolationNearest:
+				d = frame(int(math.Round(pos)), c)
+			case InterpolationSinc:
+				var sum, weights float64
+				for j := k - int(halfWidth) + 1; j <= k+int(halfWidth); j++ {
+					x := pos - float64(j)
+
+					h := 2 * cutoff
+					if x != 0 {
+						h = math.Sin(2*math.Pi*cutoff*x) / (math.Pi * x)
+					}
+					h *= blackman(x / halfWidth)
+
+					sum += h * float64(frame(j, c))
+					weights += h
+				}
+				if weights != 0 {
+					d = float32(sum / weights)
+				}
+			default:
+				d = frame(k, c)*(1-fraction) + frame(k+1, c)*fraction
+			}
+			data[i*numChannels+c] = d
+		}
+	}
+
+	w.setSamples(data, file)
+	w.length = len(data)
+	w.pointer = uint(float64(w.pointer) / ratio)
+	w.sampleRate = sampleRate
+	w.updateSizes()
+}
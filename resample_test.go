@@ -0,0 +1,113 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestResampleAliasing(t *testing.T) {
+	// rms returns the root mean square of a second of a tone of frequency
+	// rendered at 44100 Hz and resampled to sampleRate
+	rms := func(t *testing.T, frequency float32, sampleRate uint32, interpolation Interpolation) float64 {
+		t.Helper()
+		w, err := newWAV(wavFormatPCM, 1, 44100, 16, true, make([]byte, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.waveform = WaveformSine
+		w.writeTone(frequency, 0, 44100, 1, []int{}, true, false)
+		w.resample(sampleRate, interpolation)
+
+		var sum float64
+		for _, d := range w.data[:w.length] {
+			sum += float64(d) * float64(d)
+		}
+		return math.Sqrt(sum / float64(w.length))
+	}
+
+	tests := []struct {
+		name          string
+		frequency     float32
+		sampleRate    uint32
+		interpolation Interpolation
+		passed        bool
+	}{
+		{name: "linear below Nyquist", frequency: 1000, sampleRate: 22050, interpolation: InterpolationLinear, passed: true},
+		{name: "linear above Nyquist", frequency: 15000, sampleRate: 22050, interpolation: InterpolationLinear},
+		{name: "nearest above Nyquist", frequency: 15000, sampleRate: 22050, interpolation: InterpolationNearest},
+		{name: "sinc above Nyquist", frequency: 15000, sampleRate: 22050, interpolation: InterpolationSinc},
+		{name: "nearest to 8000 Hz", frequency: 6000, sampleRate: 8000, interpolation: InterpolationNearest},
+		{name: "linear upsampling", frequency: 1000, sampleRate: 48000, interpolation: InterpolationLinear, passed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a full scale sine has an RMS of 1/sqrt(2)
+			got := rms(t, tt.frequency, tt.sampleRate, tt.interpolation)
+			if tt.passed && got < 0.6 {
+				t.Errorf("RMS = %g, want the tone to pass", got)
+			}
+			if !tt.passed && got > 0.05 {
+				t.Errorf("RMS = %g, want the tone to be filtered out instead of aliased", got)
+			}
+		})
+	}
+}
+
+func TestSampleRateOutput(t *testing.T) {
+	data := smf(0, 480, track(noteOn(0, 69, 100), noteOff(480, 69)))
+
+	reference, err := MIDIToWAV(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("MIDIToWAV() error = %v", err)
+	}
+	frames := len(riffChunks(t, reference.Bytes())["data"]) / 2
+
+	tests := []struct {
+		name          string
+		sampleRate    int
+		interpolation Interpolation
+	}{
+		{name: "8000 Hz", sampleRate: 8000},
+		{name: "22050 Hz nearest", sampleRate: 22050, interpolation: InterpolationNearest},
+		{name: "48000 Hz", sampleRate: 48000},
+		{name: "96000 Hz sinc", sampleRate: 96000, interpolation: InterpolationSinc},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := MIDIToWAVWithOptions(bytes.NewReader(data), Options{
+				SampleRate:    tt.sampleRate,
+				Interpolation: tt.interpolation,
+			})
+			if err != nil {
+				t.Fatalf("MIDIToWAVWithOptions() error = %v", err)
+			}
+			chunks := riffChunks(t, buf.Bytes())
+
+			if rate := binary.LittleEndian.Uint32(chunks["fmt "][4:8]); rate != uint32(tt.sampleRate) {
+				t.Errorf("header sample rate = %d, want %d", rate, tt.sampleRate)
+			}
+			want := int(float64(frames) * float64(tt.sampleRate) / 44100)
+			if got := len(chunks["data"]) / 2; got != want {
+				t.Errorf("%d frames, want %d", got, want)
+			}
+		})
+	}
+}
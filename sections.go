@@ -0,0 +1,101 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Sections convert the MIDI into a separate WAV for each section
+// starting at a marker or cuePoint event (and at the start if no event is there)
+// keyed by the text of the event or by its time in seconds (e.g. "12.500s")
+// if it has no text
+// Sections sharing a text are keyed by the text and " (12.500s)".
+// The sections are scaled by the same factor as the whole.
+// ClipStart, ClipEnd, TrimSilence and Loops are ignored.
+func Sections(reader io.Reader, opts Options) (map[string]*bytes.Buffer, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	midi, err := parseMIDIWithHandlers(bytes.NewReader(data), nil, opts.MaxTracks)
+	if err != nil {
+		return nil, err
+	}
+	if opts.SelectSequence {
+		midi, err = midi.sequence(opts.SequenceNumber)
+		if err != nil {
+			return nil, err
+		}
+	}
+	timer, err := midi.timer(opts.TempoTrack)
+	if err != nil {
+		return nil, err
+	}
+
+	cues := midi.cues()
+	if len(cues) == 0 || cues[0].tick > 0 {
+		cues = append([]cue{{tick: 0}}, cues...)
+	}
+
+	count := make(map[string]int)
+	for _, c := range cues {
+		count[c.name]++
+	}
+
+	opts.TrimSilence = false
+	opts.Loops = 0
+
+	sections := make(map[string]*bytes.Buffer, len(cues))
+	for i, c := range cues {
+		start := timer.Time(c.tick)
+		end := 0.0
+		if i+1 < len(cues) {
+			// cues at the same time make an empty section
+			if cues[i+1].tick == c.tick {
+				continue
+			}
+			end = timer.Time(cues[i+1].tick)
+		}
+
+		opts.ClipStart = float32(start)
+		opts.ClipEnd = float32(end)
+		wav, _, err := render(bytes.NewReader(data), opts)
+		if err != nil {
+			return nil, err
+		}
+		// report the problems of the file once
+		opts.Warn = nil
+
+		name := c.name
+		switch {
+		case name == "":
+			name = fmt.Sprintf("%.3fs", start)
+		case count[name] > 1:
+			name = fmt.Sprintf("%s (%.3fs)", name, start)
+		}
+		sections[name], err = wav.encodeBuffer(opts)
+		wav.release()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sections, nil
+}
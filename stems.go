@@ -0,0 +1,78 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// Stems convert each MIDI channel playing notes into a separate WAV
+// keyed by the instrumentName (or trackName) of the channel
+// or by "channel N" if it has no name
+// Channels sharing a name are keyed by the name and " (channel N)".
+// The stems are scaled by the same factor so that they add up to the mix
+// (without the clicks of Metronome) and are written by Options.Encoder.
+func Stems(reader io.Reader, opts Options) (map[string]*bytes.Buffer, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	midi, err := parseMIDIWithHandlers(bytes.NewReader(data), nil, opts.MaxTracks)
+	if err != nil {
+		return nil, err
+	}
+
+	names := midi.channelNames()
+	channels := make([]int, 0, len(names))
+	count := make(map[string]int)
+	for channel, name := range names {
+		channels = append(channels, channel)
+		count[name]++
+	}
+	sort.Ints(channels)
+
+	stems := make(map[string]*bytes.Buffer, len(channels))
+	for _, channel := range channels {
+		channel := channel
+		opts.stemChannel = &channel
+
+		wav, _, err := render(bytes.NewReader(data), opts)
+		if err != nil {
+			return nil, err
+		}
+		// report the problems of the file once
+		opts.Warn = nil
+
+		name := names[channel]
+		switch {
+		case name == "":
+			name = fmt.Sprintf("channel %d", channel)
+		case count[name] > 1:
+			name = fmt.Sprintf("%s (channel %d)", name, channel)
+		}
+		stems[name], err = wav.encodeBuffer(opts)
+		wav.release()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stems, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStemsWithoutMetronome(t *testing.T) {
+	data := smf(1, 480,
+		track(event(0, 0xff, 0x04, 0x05, 'P', 'i', 'a', 'n', 'o')),
+		track(noteOn(0, 60, 100), noteOff(960, 60), event(0, 0x91, 64, 100), event(960, 0x81, 64, 0)),
+	)
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "metronome", opts: Options{Metronome: true}},
+		{name: "loud metronome", opts: Options{Metronome: true, MetronomeVolume: 1}},
+	}
+
+	plain, err := Stems(bytes.NewReader(data), Options{})
+	if err != nil {
+		t.Fatalf("Stems() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stems, err := Stems(bytes.NewReader(data), tt.opts)
+			if err != nil {
+				t.Fatalf("Stems() error = %v", err)
+			}
+			if len(stems) != len(plain) {
+				t.Fatalf("%d stems, want %d", len(stems), len(plain))
+			}
+			for name, stem := range stems {
+				if !bytes.Equal(stem.Bytes(), plain[name].Bytes()) {
+					t.Errorf("stem %q has the clicks of the metronome", name)
+				}
+			}
+
+			// the clicks are still in the mix
+			mix, err := MIDIToWAVWithOptions(bytes.NewReader(data), tt.opts)
+			if err != nil {
+				t.Fatalf("MIDIToWAVWithOptions() error = %v", err)
+			}
+			dry, err := MIDIToWAV(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("MIDIToWAV() error = %v", err)
+			}
+			if bytes.Equal(mix.Bytes(), dry.Bytes()) {
+				t.Errorf("mix has no clicks of the metronome")
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"unsafe"
+)
+
+// sampleFile is a temporary file mapped into memory to hold samples
+// so that the operating system can page them out to disk
+type sampleFile struct {
+	file   *os.File
+	mapped []byte
+}
+
+// newSampleFile creates an empty sample file in dir
+// (the default directory for temporary files if empty)
+func newSampleFile(dir string) (*sampleFile, error) {
+	file, err := ioutil.TempFile(dir, "synth-*.f32")
+	if err != nil {
+		return nil, err
+	}
+
+	return &sampleFile{file: file}, nil
+}
+
+// grow maps the file extended to hold n samples
+// (samples returned by the previous call are no longer valid
+// unless it fails)
+func (s *sampleFile) grow(n int) ([]float32, error) {
+	if err := s.file.Truncate(int64(n) * 4); err != nil {
+		return nil, err
+	}
+
+	mapped, err := mapFile(s.file, n*4)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.unmap(); err != nil {
+		unmapFile(mapped)
+		return nil, err
+	}
+	s.mapped = mapped
+
+	var samples []float32
+	header := (*reflect.SliceHeader)(unsafe.Pointer(&samples))
+	header.Data = uintptr(unsafe.Pointer(&mapped[0]))
+	header.Len = n
+	header.Cap = n
+	return samples, nil
+}
+
+// unmap releases the mapping of the file
+func (s *sampleFile) unmap() error {
+	if s.mapped == nil {
+		return nil
+	}
+	mapped := s.mapped
+	s.mapped = nil
+	return unmapFile(mapped)
+}
+
+// close releases the mapping and removes the file
+func (s *sampleFile) close() error {
+	err := s.unmap()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	if rerr := os.Remove(s.file.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// makeSamples returns n zeroed samples to replace the samples of w
+// in a sample file if w renders in low memory mode
+// (in memory if the file cannot be created)
+func (w *wavData) makeSamples(n int) ([]float32, *sampleFile) {
+	if !w.lowMemory || n == 0 {
+		return make([]float32, n), nil
+	}
+
+	file, err := newSampleFile(w.tempDir)
+	if err == nil {
+		var data []float32
+		if data, err = file.grow(n); err == nil {
+			return data, file
+		}
+		file.close()
+	}
+	w.storageErrs = append(w.storageErrs, err)
+	return make([]float32, n), nil
+}
+
+// setSamples replaces the samples of w by data held in file
+// and releases the file of the previous samples
+func (w *wavData) setSamples(data []float32, file *sampleFile) {
+	if w.samples != nil && w.samples != file {
+		if err := w.samples.close(); err != nil {
+			w.storageErrs = append(w.storageErrs, err)
+		}
+	}
+	w.data = data
+	w.samples = file
+}
+
+// release removes the sample file of w
+// (the samples of w are no longer valid)
+func (w *wavData) release() {
+	w.setSamples(nil, nil)
+	w.length = 0
+}
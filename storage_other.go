@@ -0,0 +1,35 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package synth
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// mapFile is not supported on this platform
+// so the samples of the low memory mode are held in memory
+func mapFile(file *os.File, size int) ([]byte, error) {
+	return nil, fmt.Errorf("%w: memory mapped files on %s", ErrUnsupportedFormat, runtime.GOOS)
+}
+
+// unmapFile is not supported on this platform
+func unmapFile(mapped []byte) error {
+	return nil
+}
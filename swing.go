@@ -0,0 +1,60 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "math"
+
+// swing delays the off-beat half beats of straight-quantized tick
+// by amount of a half beat (0 to 1) warping the time within each beat
+// of the time signature at tick so that the beats stay in place
+func swing(tick int, timeSignatures []TimeSig, ticksPerBeat int, amount float32) int {
+	if amount <= 0 || ticksPerBeat <= 0 {
+		return tick
+	}
+	if amount > 1 {
+		amount = 1
+	}
+
+	// beats of the denominator are counted from the last time signature
+	// (quarter notes until the first)
+	start, beatTicks := 0, ticksPerBeat
+	for _, sig := range timeSignatures {
+		if sig.Tick > tick {
+			break
+		}
+		if sig.Denominator > 0 {
+			start, beatTicks = sig.Tick, ticksPerBeat*4/sig.Denominator
+		}
+	}
+	if beatTicks <= 0 {
+		return tick
+	}
+
+	var (
+		beat = (tick - start) / beatTicks
+		// position within the beat (0 to 1)
+		position = float64((tick-start)%beatTicks) / float64(beatTicks)
+		s        = float64(amount)
+	)
+
+	// the half beat moves to (1 + s) / 2
+	if position < 0.5 {
+		position *= 1 + s
+	} else {
+		position = (1+s)/2 + (position-0.5)*(1-s)
+	}
+
+	return start + beat*beatTicks + int(math.Round(position*float64(beatTicks)))
+}
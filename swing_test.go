@@ -0,0 +1,87 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "testing"
+
+func TestSwing(t *testing.T) {
+	// 4/4 until 6/8 at the third bar and 2/2 at the fourth bar
+	signatures := []TimeSig{
+		{Tick: 0, Numerator: 4, Denominator: 4},
+		{Tick: 3840, Numerator: 6, Denominator: 8},
+		{Tick: 5280, Numerator: 2, Denominator: 2},
+	}
+
+	tests := []struct {
+		name       string
+		tick       int
+		signatures []TimeSig
+		amount     float32
+		want       int
+	}{
+		{name: "straight", tick: 240, signatures: signatures, amount: 0, want: 240},
+		{name: "on the beat", tick: 480, signatures: signatures, amount: 0.5, want: 480},
+		{name: "off-beat eighth", tick: 720, signatures: signatures, amount: 0.5, want: 840},
+		{name: "triplet feel", tick: 720, signatures: signatures, amount: 1.0 / 3, want: 800},
+		{name: "full swing", tick: 240, signatures: signatures, amount: 2, want: 480},
+		{name: "first sixteenth", tick: 120, signatures: signatures, amount: 0.5, want: 180},
+		{name: "on the eighth of 6/8", tick: 3840 + 240, signatures: signatures, amount: 0.5, want: 3840 + 240},
+		{name: "off-beat sixteenth of 6/8", tick: 3840 + 360, signatures: signatures, amount: 0.5, want: 3840 + 420},
+		{name: "eighth of 6/8 unchanged", tick: 3840 + 480, signatures: signatures, amount: 0.5, want: 3840 + 480},
+		{name: "on the half note of 2/2", tick: 5280 + 960, signatures: signatures, amount: 0.5, want: 5280 + 960},
+		{name: "off-beat quarter of 2/2", tick: 5280 + 480, signatures: signatures, amount: 0.5, want: 5280 + 720},
+		{name: "quarter notes without time signatures", tick: 240, amount: 0.5, want: 360},
+		{name: "off-beat of 4/64", tick: 15, signatures: []TimeSig{{Numerator: 4, Denominator: 64}}, amount: 0.5, want: 23},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := swing(tt.tick, tt.signatures, 480, tt.amount); got != tt.want {
+				t.Errorf("swing(%d) = %d, want %d", tt.tick, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSwingNotes(t *testing.T) {
+	// eighth notes in 4/4 and sixteenth notes in 6/8 at 120 bpm
+	data := smf(0, 480, track(
+		noteOn(0, 60, 100), noteOff(240, 60),
+		noteOn(0, 62, 100), noteOff(240, 62),
+		event(0, 0xff, 0x58, 0x04, 0x06, 0x03, 0x18, 0x08),
+		noteOn(0, 64, 100), noteOff(120, 64),
+		noteOn(0, 65, 100), noteOff(120, 65),
+	))
+
+	tests := []struct {
+		note   string
+		offset float64
+	}{
+		{note: "C4", offset: 0},
+		{note: "D4", offset: 0.375},
+		{note: "E4", offset: 0.5},
+		{note: "F4", offset: 0.6875},
+	}
+
+	prog := collect(t, data, Options{Swing: 0.5})
+	if len(prog) != len(tests) {
+		t.Fatalf("collected %d notes, want %d", len(prog), len(tests))
+	}
+	for i, tt := range tests {
+		if prog[i].note != tt.note || prog[i].offset != tt.offset {
+			t.Errorf("note %d is %s at %g s, want %s at %g s", i, prog[i].note, prog[i].offset, tt.note, tt.offset)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Synth writes notes into WAV sound data.
+// Unlike the conversion functions, which do not share any state,
+// a Synth holds a write position and is guarded by a mutex
+// so it is safe for concurrent use by multiple goroutines.
+type Synth struct {
+	mu  sync.Mutex
+	wav *wavData
+}
+
+// NewSynth creates an empty synth
+func NewSynth() *Synth {
+	wav, _ := newWAV(wavFormatPCM, 1, 44100, 16, true, make([]byte, 0))
+
+	return &Synth{
+		wav: wav,
+	}
+}
+
+// Seek sets the write position in seconds
+func (s *Synth) Seek(time float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.wav.seek(time)
+}
+
+// WriteNote writes note at the write position
+// for amount of time in seconds at given normalized amplitude
+// blending with existing data and moves the write position to the end of the note.
+// Note is named by tone, octave and accidental (e.g. "A4" or "C5#")
+// in scientific pitch notation where middle C (MIDI note 60) is "C4".
+// It returns ErrInvalidNote without writing if note is unrecognized
+// and ErrInvalidAmplitude if amplitude is outside of 0 to 1
+// (notes written over each other may still add up beyond 1).
+func (s *Synth) WriteNote(note string, time float32, amplitude float32) error {
+	if !(amplitude >= 0 && amplitude <= 1) {
+		return fmt.Errorf("%w: %g is outside of 0 to 1", ErrInvalidAmplitude, amplitude)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.wav.writeNote(note, time, amplitude, []int{}, true, false, 1)
+}
+
+// Buffer returns the WAV of written notes
+func (s *Synth) Buffer() *bytes.Buffer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.wav.toBuffer()
+}
+
+// WriteTo writes the WAV of written notes to writer
+// without holding a copy of the whole WAV
+func (s *Synth) WriteTo(writer io.Writer) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.wav.WriteTo(writer)
+}
+
+// ReferenceTone renders a tone of the frequency in Hz for seconds
+// with the waveform of opts at the amplitude (0 to 1 of full scale)
+// lowered by Headroom (e.g. to calibrate a playback chain)
+func ReferenceTone(frequency float32, seconds float32, amplitude float32, opts Options) (*bytes.Buffer, error) {
+	if frequency <= 0 || seconds <= 0 {
+		return nil, fmt.Errorf("%w: reference tone of %g Hz for %g seconds", ErrInvalidOption, frequency, seconds)
+	}
+	if amplitude <= 0 || amplitude > 1 {
+		return nil, fmt.Errorf("%w: reference tone amplitude %g is outside of 0 to 1", ErrInvalidOption, amplitude)
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	oversample := maxInt(opts.Oversample, 1)
+
+	wav, err := newWAV(wavFormatPCM, opts.numChannels(), 44100*uint32(oversample), opts.bitsPerSample(), true, make([]byte, 0))
+	if err != nil {
+		return nil, err
+	}
+	wav.fadeCurve = opts.FadeCurve
+	wav.waveform = opts.Waveform
+	wav.squareDuty = opts.squareDuty()
+
+	wav.writeTone(frequency, 0, wav.frame(float64(seconds)), amplitude*opts.headroomGain(), []int{}, true, false)
+	wav.decimate(oversample)
+	wav.resample(opts.sampleRate(), opts.Interpolation)
+
+	return wav.encodeBuffer(opts)
+}
+
+// AuditionNote renders a single note of the MIDI note number and velocity
+// sustained for seconds with the sound and the effects of opts
+// normalized in the same way as a conversion (e.g. to preview an instrument)
+func AuditionNote(noteNumber int, velocity int, seconds float32, opts Options) (*bytes.Buffer, error) {
+	if noteNumber < minNoteNumber || noteNumber > maxNoteNumber {
+		return nil, fmt.Errorf("%w: note number %d", ErrInvalidNote, noteNumber)
+	}
+	if velocity < 1 || velocity > 127 || seconds <= 0 {
+		return nil, fmt.Errorf("%w: audition of velocity %d for %g seconds", ErrInvalidOption, velocity, seconds)
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	pitch, ok := transpose(noteNumber, opts.Transpose, opts.TransposePolicy)
+	if !ok {
+		return nil, fmt.Errorf("%w: note number %d transposed by %d", ErrInvalidNote, noteNumber, opts.Transpose)
+	}
+	note, err := noteFromSemitone(pitch)
+	if err != nil {
+		return nil, err
+	}
+	velocity = opts.velocity(velocity)
+
+	// a single note is normalized by its own velocity
+	maxAmplitude := 128 / float32(velocity) * opts.headroomGain()
+	if opts.DisableNormalization {
+		maxAmplitude = 1
+	}
+	if opts.Gain > 0 {
+		maxAmplitude = opts.Gain
+	}
+
+	oversample := maxInt(opts.Oversample, 1)
+
+	wav, err := newOutput(opts, oversample)
+	if err != nil {
+		return nil, err
+	}
+	defer wav.release()
+
+	prog := []*progression{{
+		note:      note,
+		time:      float64(seconds) * float64(opts.articulation()),
+		amplitude: float32(velocity) / 128,
+		cents:     opts.PitchShiftCents,
+	}}
+	opts.warn(wav.writeProgression(prog, maxAmplitude, []int{}, true, true, 1)...)
+	wav.decimate(oversample)
+	wav.resample(opts.sampleRate(), opts.Interpolation)
+
+	err = wav.applyEffects(wav, opts)
+	opts.warn(wav.storageErrs...)
+	if err != nil {
+		return nil, err
+	}
+
+	return wav.encodeBuffer(opts)
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestSynthConcurrentUse(t *testing.T) {
+	s := NewSynth()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				s.Seek(float32(j) * 0.01)
+				if err := s.WriteNote("A4", 0.01, 0.05); err != nil {
+					t.Errorf("WriteNote() error = %v", err)
+					return
+				}
+				if i%2 == 0 {
+					s.Buffer()
+				} else if _, err := s.WriteTo(ioutil.Discard); err != nil {
+					t.Errorf("WriteTo() error = %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// the writes of other goroutines move the write position between Seek and WriteNote
+	// but the header always agrees with the data
+	if err := s.wav.validateHeader(); err != nil {
+		t.Errorf("validateHeader() error = %v", err)
+	}
+	if _, err := decodeWAV(s.Buffer().Bytes()); err != nil {
+		t.Errorf("decodeWAV() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil || !bytes.Equal(buf.Bytes(), s.Buffer().Bytes()) {
+		t.Errorf("WriteTo() differs from Buffer() (error = %v)", err)
+	}
+}
+
+func TestConcurrentConversions(t *testing.T) {
+	data := smf(0, 480, track(noteOn(0, 60, 100), noteOn(0, 64, 100), noteOff(480, 60), noteOff(0, 64)))
+	want, err := MIDIToWAV(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("MIDIToWAV() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := MIDIToWAV(bytes.NewReader(data))
+			if err != nil || !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Errorf("concurrent MIDIToWAV() differs (error = %v)", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestReferenceTone(t *testing.T) {
+	tests := []struct {
+		name      string
+		amplitude float32
+		opts      Options
+		err       error
+		peak      float64
+	}{
+		{name: "full scale sine", amplitude: 1, peak: 1},
+		{name: "half scale sine", amplitude: 0.5, peak: 0.5},
+		{name: "square", amplitude: 0.25, opts: Options{Waveform: WaveformSquare}, peak: 0.25},
+		{name: "headroom", amplitude: 1, opts: Options{Headroom: 20}, peak: 0.1},
+		{name: "zero amplitude", amplitude: 0, err: ErrInvalidOption},
+		{name: "negative amplitude", amplitude: -0.5, err: ErrInvalidOption},
+		{name: "amplitude above full scale", amplitude: 1.5, err: ErrInvalidOption},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := ReferenceTone(1000, 0.1, tt.amplitude, tt.opts)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ReferenceTone() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			samples := riffChunks(t, buf.Bytes())["data"]
+			var peak float64
+			for i := 0; i+1 < len(samples); i += 2 {
+				s := float64(int16(binary.LittleEndian.Uint16(samples[i:])))
+				peak = math.Max(peak, math.Abs(s)/math.MaxInt16)
+			}
+			if math.Abs(peak-tt.peak) > 0.01 {
+				t.Errorf("peak = %g, want %g", peak, tt.peak)
+			}
+		})
+	}
+}
+
+func TestWriteNoteAmplitude(t *testing.T) {
+	tests := []struct {
+		amplitude float32
+		err       error
+	}{
+		{0, nil},
+		{0.5, nil},
+		{1, nil},
+		{2, ErrInvalidAmplitude},
+		{1.01, ErrInvalidAmplitude},
+		{-0.1, ErrInvalidAmplitude},
+		{float32(math.NaN()), ErrInvalidAmplitude},
+		{float32(math.Inf(1)), ErrInvalidAmplitude},
+	}
+
+	for _, tt := range tests {
+		s := NewSynth()
+		err := s.WriteNote("A4", 0.1, tt.amplitude)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("WriteNote(%v) error = %v, want %v", tt.amplitude, err, tt.err)
+		}
+
+		// rejected notes are not written
+		var want uint
+		if tt.err == nil {
+			want = uint(s.wav.frame(0.1))
+		}
+		if s.wav.pointer != want {
+			t.Errorf("WriteNote(%v) moved to %d, want %d", tt.amplitude, s.wav.pointer, want)
+		}
+		var peak float32
+		for _, d := range s.wav.data {
+			peak = float32(math.Max(float64(peak), math.Abs(float64(d))))
+		}
+		if tt.err != nil && peak != 0 {
+			t.Errorf("WriteNote(%v) wrote a peak of %v, want nothing written", tt.amplitude, peak)
+		} else if tt.err == nil && peak > tt.amplitude {
+			t.Errorf("WriteNote(%v) wrote a peak of %v", tt.amplitude, peak)
+		}
+	}
+}
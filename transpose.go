@@ -0,0 +1,55 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+// TransposePolicy decides how notes transposed outside of the MIDI range (0-127) are handled
+type TransposePolicy int
+
+const (
+	// TransposeClamp moves the note to the nearest valid note
+	TransposeClamp TransposePolicy = iota
+	// TransposeWrap moves the note by octaves until it is valid
+	TransposeWrap
+	// TransposeSkip drops the note
+	TransposeSkip
+)
+
+const (
+	minNoteNumber = 0
+	maxNoteNumber = 127
+)
+
+// transpose shifts semitone by offset applying policy when the result is out of range
+// and reports false if the note should be skipped
+func transpose(semitone, offset int, policy TransposePolicy) (int, bool) {
+	semitone += offset
+	if semitone >= minNoteNumber && semitone <= maxNoteNumber {
+		return semitone, true
+	}
+
+	switch policy {
+	case TransposeWrap:
+		// the same pitch class in the lowest or the highest octave of the range
+		// (computed at once however far the note is)
+		if semitone < minNoteNumber {
+			return minNoteNumber + ((semitone-minNoteNumber)%12+12)%12, true
+		}
+		return maxNoteNumber - ((maxNoteNumber-semitone)%12+12)%12, true
+	case TransposeSkip:
+		return semitone, false
+	default:
+		return maxInt(minNoteNumber, minInt(semitone, maxNoteNumber)), true
+	}
+}
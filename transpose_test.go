@@ -0,0 +1,171 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestTranspose(t *testing.T) {
+	tests := []struct {
+		name     string
+		semitone int
+		offset   int
+		policy   TransposePolicy
+		want     int
+		ok       bool
+	}{
+		{"in range", 60, 12, TransposeClamp, 72, true},
+		{"upper bound", 120, 7, TransposeSkip, 127, true},
+		{"lower bound", 5, -5, TransposeSkip, 0, true},
+		{"clamp above", 120, 8, TransposeClamp, 127, true},
+		{"clamp below", 5, -6, TransposeClamp, 0, true},
+		{"wrap above", 120, 8, TransposeWrap, 116, true},
+		{"wrap below", 5, -6, TransposeWrap, 11, true},
+		{"wrap far above", 100, 60, TransposeWrap, 124, true},
+		{"wrap far below", 60, -1000, TransposeWrap, 8, true},
+		{"wrap huge offset above", 60, math.MaxInt32, TransposeWrap, 127, true},
+		{"wrap huge offset below", 60, math.MinInt32, TransposeWrap, 4, true},
+		{"skip above", 120, 8, TransposeSkip, 128, false},
+		{"skip below", 5, -6, TransposeSkip, -1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := transpose(tt.semitone, tt.offset, tt.policy)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("transpose(%d, %d) = %d, %v, want %d, %v", tt.semitone, tt.offset, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTransposePolicy(t *testing.T) {
+	data := smf(0, 480, track(
+		noteOn(0, 0, 100),
+		noteOn(0, 127, 100),
+		noteOff(480, 0),
+		noteOff(0, 127),
+	))
+
+	tests := []struct {
+		policy    TransposePolicy
+		transpose int
+		want      []string
+	}{
+		{TransposeClamp, 1, []string{"C-1#", "G9"}},
+		{TransposeClamp, -1, []string{"C-1", "F9#"}},
+		{TransposeWrap, 1, []string{"C-1#", "G8#"}},
+		{TransposeWrap, -1, []string{"B-1", "F9#"}},
+		{TransposeSkip, 1, []string{"C-1#"}},
+		{TransposeSkip, -1, []string{"F9#"}},
+	}
+
+	for _, tt := range tests {
+		prog := collect(t, data, Options{Transpose: tt.transpose, TransposePolicy: tt.policy})
+
+		var got []string
+		for _, note := range prog {
+			got = append(got, note.note)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("policy %d by %d rendered %v, want %v", tt.policy, tt.transpose, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("policy %d by %d rendered %v, want %v", tt.policy, tt.transpose, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestChannelTranspose(t *testing.T) {
+	// the same pitch on channels 0 and 1 with their noteOff events interleaved
+	data := smf(0, 480, track(
+		noteOn(0, 60, 100),
+		event(0, 0x91, 60, 100),
+		event(0, 0x91, 2, 100),
+		event(480, 0x81, 60, 0),
+		event(0, 0x81, 2, 0),
+		// a stray noteOff of channel 2 does not end the note of channel 0
+		event(0, 0x82, 60, 0),
+		noteOff(480, 60),
+	))
+
+	type note struct {
+		name           string
+		offset, length float64
+		channel        int
+	}
+
+	tests := []struct {
+		name  string
+		opts  Options
+		notes []note
+	}{
+		{
+			name:  "none",
+			opts:  Options{},
+			notes: []note{{"D-1", 0, 0.5, 1}, {"C4", 0, 0.5, 1}, {"C4", 0, 1, 0}},
+		},
+		{
+			name:  "channel 1 an octave down",
+			opts:  Options{ChannelTranspose: map[int]int{1: -12}, TransposePolicy: TransposeSkip},
+			notes: []note{{"C3", 0, 0.5, 1}, {"C4", 0, 1, 0}},
+		},
+		{
+			name:  "channel 1 clamped",
+			opts:  Options{ChannelTranspose: map[int]int{1: -12}, TransposePolicy: TransposeClamp},
+			notes: []note{{"C-1", 0, 0.5, 1}, {"C3", 0, 0.5, 1}, {"C4", 0, 1, 0}},
+		},
+		{
+			name:  "global and channel 1",
+			opts:  Options{Transpose: 2, ChannelTranspose: map[int]int{1: 10}},
+			notes: []note{{"D0", 0, 0.5, 1}, {"D4", 0, 1, 0}, {"C5", 0, 0.5, 1}},
+		},
+		{
+			name:  "another channel",
+			opts:  Options{ChannelTranspose: map[int]int{5: 7}},
+			notes: []note{{"D-1", 0, 0.5, 1}, {"C4", 0, 0.5, 1}, {"C4", 0, 1, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings []error
+			tt.opts.Warn = func(err error) { warnings = append(warnings, err) }
+
+			prog := collect(t, data, tt.opts)
+			if len(prog) != len(tt.notes) {
+				t.Fatalf("collected %d notes, want %d", len(prog), len(tt.notes))
+			}
+			for i, want := range tt.notes {
+				p := prog[i]
+				if p.note != want.name || p.offset != want.offset || p.time != want.length || p.channel != want.channel {
+					t.Errorf("note %d is %s at %g s for %g s on channel %d, want %s at %g s for %g s on channel %d",
+						i, p.note, p.offset, p.time, p.channel, want.name, want.offset, want.length, want.channel)
+				}
+			}
+
+			if len(warnings) != 1 || !errors.Is(warnings[0], ErrInvalidNote) {
+				t.Errorf("warned %v, want the stray noteOff", warnings)
+			}
+		})
+	}
+}
@@ -17,26 +17,28 @@ package synth
 import (
 	"bytes"
 	"encoding/binary"
-	"errors"
 	"fmt"
+	"io"
 	"math"
 	"regexp"
 )
 
-func semitoneFromNote(note string) (int, error) {
-	// matches occurrence of A through G
-	// followed by positive or negative integer
-	// followed by 0 to 2 occurrences of flat or sharp
-	const re = `^([A-G])(\-?\d+)(b{0,2}|#{0,2})$`
+// notePattern matches occurrence of A through G
+// followed by positive or negative integer
+// followed by 0 to 2 occurrences of flat or sharp
+// (compiled once as it is used for every note of the progression)
+var notePattern = regexp.MustCompile(`^([A-G])(\-?\d+)(b{0,2}|#{0,2})$`)
 
+// semitoneFromNote converts note name into semitone index (MIDI note number)
+// using scientific pitch notation where middle C is C4 (60) and C-1 is 0
+func semitoneFromNote(note string) (int, error) {
 	// if semitone is unrecognized, assume REST
-	matched, _ := regexp.MatchString(re, note)
-	if !matched {
-		return 0, errors.New("invalid note")
+	s := notePattern.FindStringSubmatch(note)
+	if s == nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidNote, note)
 	}
 
 	// parse substrings of note
-	s := regexp.MustCompile(re).FindAllStringSubmatch(note, 1)[0]
 	tone, octave, accidental := s[1], s[2], s[3]
 
 	var (
@@ -52,20 +54,22 @@ func semitoneFromNote(note string) (int, error) {
 	)
 
 	if _, ok := tones[tone]; !ok {
-		return 0, errors.New("invalid tone in note")
+		return 0, fmt.Errorf("%w: invalid tone in %q", ErrInvalidNote, note)
 	}
 
 	if _, ok := octaves[octave]; !ok {
-		return 0, errors.New("invalid octave in note")
+		return 0, fmt.Errorf("%w: invalid octave in %q", ErrInvalidNote, note)
 	}
 
 	if _, ok := accidentals[accidental]; !ok {
-		return 0, errors.New("invalid accidental in note")
+		return 0, fmt.Errorf("%w: invalid accidental in %q", ErrInvalidNote, note)
 	}
 
 	return tones[tone] + octaves[octave]*12 + accidentals[accidental], nil
 }
 
+// noteFromSemitone converts semitone index (MIDI note number) into note name
+// using the same convention as semitoneFromNote (60 is C4)
 func noteFromSemitone(semitone int) (string, error) {
 	var (
 		octaves = []int{
@@ -80,11 +84,11 @@ func noteFromSemitone(semitone int) (string, error) {
 	toneIndex := semitone - octaveIndex*12
 
 	if octaveIndex >= len(octaves) {
-		return "REST", errors.New("invalid octave")
+		return "REST", fmt.Errorf("%w: invalid octave of semitone %d", ErrInvalidNote, semitone)
 	}
 
 	if toneIndex >= len(tones) {
-		return "REST", errors.New("invalid tone")
+		return "REST", fmt.Errorf("%w: invalid tone of semitone %d", ErrInvalidNote, semitone)
 	}
 
 	tone := []rune(tones[toneIndex])
@@ -103,23 +107,95 @@ func frequencyFromSemitone(semitone int) float32 {
 	return float32(440 * math.Pow(2, float64(semitone-69)/12))
 }
 
+// detune shifts frequency by cents (hundredths of a semitone)
+func detune(frequency float32, cents float32) float32 {
+	if cents == 0 {
+		return frequency
+	}
+	return frequency * float32(math.Pow(2, float64(cents)/1200))
+}
+
+// audio format of integer samples
+const wavFormatPCM = 0x0001
+
+// audio format of floating point samples
+const wavFormatFloat = 0x0003
+
+// audio format whose actual format is given in the extension of the fmt chunk
+const wavFormatExtensible = 0xFFFE
+
+// defaultChannelMask returns the speaker positions of the common layouts
+// (e.g. 5.1 for 6 channels) or zero for unknown positions
+func defaultChannelMask(numChannels uint16) uint32 {
+	switch numChannels {
+	case 1:
+		return 0x4 // front center
+	case 2:
+		return 0x3 // front left and right
+	case 3:
+		return 0x7 // front left, right and center
+	case 4:
+		return 0x33 // front and back left and right
+	case 5:
+		return 0x37 // 4 channels and front center
+	case 6:
+		return 0x3F // 5.1
+	case 8:
+		return 0x63F // 7.1
+	default:
+		return 0
+	}
+}
+
 type wavData struct {
 	header        []byte
 	data          []float32
 	pointer       uint
+	length        int
+	audioFormat   uint16
+	factOffset    int
+	maskOffset    int
 	numChannels   uint16
 	sampleRate    uint32
 	bitsPerSample int
 	chunkSize     uint32
 	subChunk2Size uint32
+	fadeCurve     FadeCurve
+	noiseColor    NoiseColor
+	noiseSeed     uint32
+	phaseSpread   float64
+	phaseSeed     uint32
+	waveform      Waveform
+	squareDuty    float64
+	// compensate amplitude of tones for the perceived loudness
+	equalLoudness bool
+	// interpolation of the bend of notes
+	pitchBend PitchBend
+	// speaker positions of the channels in the extensible format
+	channelMask uint32
+	// fields of the bext chunk in the header
+	bext *BroadcastExtension
+	// copyright in the INFO chunk in the header
+	copyright string
+	// hold the samples in temporary files in tempDir
+	lowMemory bool
+	tempDir   string
+	// file of the samples in low memory mode
+	samples *sampleFile
+	// problems of the sample files
+	storageErrs []error
 }
 
-func newWAV(numChannels uint16, sampleRate uint32, bitsPerSample int, littleEndian bool, data []byte) (*wavData, error) {
+func newWAV(audioFormat uint16, numChannels uint16, sampleRate uint32, bitsPerSample int, littleEndian bool, data []byte) (*wavData, error) {
 	if !littleEndian {
-		return nil, errors.New("big endian is not supported")
+		return nil, fmt.Errorf("%w: big endian", ErrUnsupportedFormat)
 	}
 
-	// WAV header is always 44 bytes
+	if bitsPerSample != 8 && bitsPerSample != 16 && bitsPerSample != 24 && bitsPerSample != 32 {
+		return nil, fmt.Errorf("%w: %d bits per sample", ErrUnsupportedFormat, bitsPerSample)
+	}
+
+	// PCM WAV header is always 44 bytes
 	header := []byte{
 		0x52, 0x49, 0x46, 0x46, // chunk id ("RIFF")
 		0x00, 0x00, 0x00, 0x00, // chunk size
@@ -127,29 +203,112 @@ func newWAV(numChannels uint16, sampleRate uint32, bitsPerSample int, littleEndi
 		0x66, 0x6D, 0x74, 0x20, // subchunk1 id ("fmt")
 		0x10, 0x00, 0x00, 0x00, // subchunk1 size
 		0x01, 0x00, // audio format
-		0x01, 0x00, // num channels
-		0x44, 0xAC, 0x00, 0x00, // sample rate
-		0x88, 0x58, 0x01, 0x00, // byte rate
-		0x02, 0x00, // block align
-		0x10, 0x00, // bits per sample
+		0x00, 0x00, // num channels
+		0x00, 0x00, 0x00, 0x00, // sample rate
+		0x00, 0x00, 0x00, 0x00, // byte rate
+		0x00, 0x00, // block align
+		0x00, 0x00, // bits per sample
+	}
+
+	// more than 2 channels require the extensible format
+	// giving the actual format in the sub format
+	subFormat := audioFormat
+	if audioFormat == wavFormatExtensible || numChannels > 2 {
+		audioFormat = wavFormatExtensible
+		if subFormat == wavFormatExtensible {
+			subFormat = wavFormatPCM
+		}
+	}
+
+	binary.LittleEndian.PutUint16(header[20:22], audioFormat)
+
+	// offset of the channel mask in the extension of the fmt chunk
+	maskOffset := 0
+	if audioFormat == wavFormatExtensible {
+		header[16] = 0x28 // subchunk1 size
+		maskOffset = len(header) + 4
+		header = append(header,
+			0x16, 0x00, // extension size
+			0x00, 0x00, // valid bits per sample
+			0x00, 0x00, 0x00, 0x00, // channel mask
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, // sub format GUID
+			0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71,
+		)
+		binary.LittleEndian.PutUint16(header[maskOffset+4:maskOffset+6], subFormat)
+	}
+
+	// non-PCM formats require an extended fmt chunk
+	// followed by a fact chunk holding the number of sample frames
+	// offset of sample frames in the fact chunk
+	factOffset := 0
+	if subFormat != wavFormatPCM {
+		if audioFormat != wavFormatExtensible {
+			header[16] = 0x12 // subchunk1 size
+			header = append(header,
+				0x00, 0x00, // extension size
+			)
+		}
+		factOffset = len(header) + 8
+		header = append(header,
+			0x66, 0x61, 0x63, 0x74, // fact chunk id ("fact")
+			0x04, 0x00, 0x00, 0x00, // fact chunk size
+			0x00, 0x00, 0x00, 0x00, // sample frames
+		)
+	}
+
+	header = append(header,
 		0x64, 0x61, 0x74, 0x61, // subchunk2 id ("data")
 		0x00, 0x00, 0x00, 0x00, // subchunk2 size
-	}
+	)
 
-	return &wavData{
+	w := &wavData{
 		header:        header,
 		data:          nil,
 		pointer:       0,
+		length:        0,
+		audioFormat:   subFormat,
+		factOffset:    factOffset,
+		maskOffset:    maskOffset,
+		channelMask:   defaultChannelMask(numChannels),
 		numChannels:   numChannels,
 		sampleRate:    sampleRate,
 		bitsPerSample: bitsPerSample,
-	}, nil
+		squareDuty:    defaultSquareDuty,
+	}
+	w.updateSizes()
+
+	return w, nil
+}
+
+// blockAlign returns the number of bytes in a frame of all channels
+func (w *wavData) blockAlign() uint16 {
+	return w.numChannels * uint16(w.bitsPerSample>>3)
+}
+
+// byteRate returns the number of bytes per second
+func (w *wavData) byteRate() uint32 {
+	return w.sampleRate * uint32(w.blockAlign())
+}
+
+// size returns the number of bytes of the WAV
+// holding seconds of sound data at sampleRate
+func (w *wavData) size(seconds float64, sampleRate uint32) int {
+	frames := int(math.Round(float64(sampleRate) * seconds))
+	return len(w.header) + frames*int(w.blockAlign())
 }
 
 // seek sets time (in seconds) of pointer zero-fills by default
+// clamping negative time to the start
 func (w *wavData) seek(time float32) {
-	sample := int(math.Round(float64(w.sampleRate) * float64(time)))
-	w.pointer = uint(w.numChannels) * uint(sample)
+	if time < 0 {
+		time = 0
+	}
+	w.pointer = uint(w.numChannels) * uint(w.frame(float64(time)))
+}
+
+// frame converts time in seconds into the nearest frame index
+func (w *wavData) frame(time float64) int {
+	return int(math.Round(float64(w.sampleRate) * time))
 }
 
 // writeNote writes the specified note to the sound data
@@ -158,28 +317,71 @@ func (w *wavData) seek(time float32) {
 // to channels listed (or all by default)
 // adds to existing data by default
 // and does not reset write index after operation by default
-func (w *wavData) writeNote(note string, time float32, amplitude float32, channels []int, blend bool, reset bool, relativeDuration int) {
+// Nothing is written if note is unrecognized.
+func (w *wavData) writeNote(note string, time float32, amplitude float32, channels []int, blend bool, reset bool, relativeDuration int) error {
+	semitone, err := semitoneFromNote(note)
+	if err != nil {
+		return err
+	}
+	frequency := frequencyFromSemitone(semitone)
+	if w.equalLoudness {
+		amplitude *= loudnessGain(frequency)
+	}
+	w.writeTone(frequency, 0, w.frame(float64(time)), amplitude, channels, blend, reset)
+	return nil
+}
+
+// writeTone writes a tone of the frequency in Hz
+// for amount of frames in the same way as writeNote
+// continuing the phase of a tone which already sounded for elapsed frames
+func (w *wavData) writeTone(frequency float32, elapsed int, blocksOut int, amplitude float32, channels []int, blend bool, reset bool) {
+	w.writeWave(w.toneWave(frequency, elapsed, 0), blocksOut, amplitude, channels, blend, reset)
+}
+
+// toneWave returns the generator of a tone of the frequency in Hz
+// (or nil for silence if frequency is not positive)
+// continuing the phase of a tone which already sounded for elapsed frames
+// and starting offset cycles later
+func (w *wavData) toneWave(frequency float32, elapsed int, offset float64) func(i int) float32 {
 	var (
-		numChannels = w.numChannels
-		sampleRate  = w.sampleRate
+		// cycles per sample
+		step  = float64(frequency) / float64(w.sampleRate)
+		phase = w.waveform.startPhase() + offset
+	)
 
-		// to prevent sound artifacts
-		fadeSeconds float32 = 0.001
+	if step <= 0 {
+		return nil
+	}
+	return func(i int) float32 {
+		return w.waveform.sample(phase+step*float64(elapsed+i), w.squareDuty)
+	}
+}
 
-		// calculating properties of given note
-		semitone, _ = semitoneFromNote(note)
-		frequency   = float32(frequencyFromSemitone(semitone)) * math.Pi * 2 / float32(sampleRate)
+// withEnvelope scales the samples generated by wave by the gain of envelope
+func (w *wavData) withEnvelope(wave func(i int) float32, envelope []gainPoint) func(i int) float32 {
+	if wave == nil || len(envelope) == 0 {
+		return wave
+	}
+	return func(i int) float32 {
+		return wave(i) * envelopeGain(envelope, float64(i)/float64(w.sampleRate))
+	}
+}
+
+// writeWave writes the normalized samples generated by wave
+// (or silence if wave is nil) for amount of frames in the same way as writeNote
+func (w *wavData) writeWave(wave func(i int) float32, blocksOut int, amplitude float32, channels []int, blend bool, reset bool) {
+	var (
+		numChannels = w.numChannels
+		sampleRate  = w.sampleRate
 
-		// amount of blocks to be written
-		blocksOut = int(math.Round(float64(sampleRate) * float64(time)))
 		// reduces sound artifacts by fading at last fadeSeconds
 		nonZero = float32(blocksOut) - float32(sampleRate)*fadeSeconds
 		// fade interval in samples
 		fade = float32(sampleRate)*fadeSeconds + 1
 
-		// index of start and stop samples
+		// index of start sample and end of written samples
 		start = int(w.pointer)
-		stop  = len(w.data)
+		stop  = w.length
 
 		// k = cached index of data
 		// d = sample data value
@@ -194,26 +396,24 @@ func (w *wavData) writeNote(note string, time float32, amplitude float32, channe
 		}
 	}
 
-	skipChannels := make([]bool, numChannels)
-	for i := 0; i < len(skipChannels); i++ {
-		skipChannels[i] = channels[i] == -1
-	}
+	w.grow(start + blocksOut*int(numChannels))
 
 	// update existing data
 	for i := 0; i < blocksOut; i++ {
+		d = 0
+
+		if wave != nil {
+			d = amplitude * wave(i)
+			if float32(i) < fade {
+				d *= w.fadeCurve.gain(float32(i) / fade)
+			} else if float32(i) > nonZero {
+				d *= w.fadeCurve.gain(float32(blocksOut-i+1) / fade)
+			}
+		}
+
 		// iterate through specified channels
 		for j := 0; j < len(channels); j++ {
 			k = start + i*int(numChannels) + channels[j]
-			d = 0
-
-			if frequency > 0 {
-				d = amplitude * float32(math.Sin(float64(frequency)*float64(i)))
-				if float32(i) < fade {
-					d *= float32(i) / fade
-				} else if float32(i) > nonZero {
-					d *= float32(blocksOut-i+1) / fade
-				}
-			}
 
 			if blend {
 				w.data[k] = d + w.data[k]
@@ -223,78 +423,327 @@ func (w *wavData) writeNote(note string, time float32, amplitude float32, channe
 		}
 	}
 
-	end := maxInt(start+blocksOut*int(numChannels), stop) * (w.bitsPerSample >> 3)
+	// header sizes reflect the written samples rather than the allocated buffer
+	w.length = maxInt(start+blocksOut*int(numChannels), stop)
+	w.updateSizes()
+
+	if !reset {
+		w.pointer = uint(start + blocksOut*int(numChannels))
+	}
+}
+
+// grow extends the sound data to hold at least n samples
+func (w *wavData) grow(n int) {
+	if n <= len(w.data) {
+		return
+	}
+	if n <= cap(w.data) {
+		w.data = w.data[:n]
+		return
+	}
+	size := maxInt(n, 2*cap(w.data))
+	if w.samples != nil {
+		// the file keeps the samples when it is mapped again
+		data, err := w.samples.grow(size)
+		if err == nil {
+			w.data = data[:n]
+			return
+		}
+		w.storageErrs = append(w.storageErrs, err)
+	}
+	data, file := w.makeSamples(size)
+	copy(data, w.data)
+	w.setSamples(data[:n], file)
+}
+
+// updateSizes patches the chunk sizes in the header from the written samples
+// along with the fields of the format (which changes on resampling)
+func (w *wavData) updateSizes() {
+	end := w.length * (w.bitsPerSample >> 3)
 	w.chunkSize = uint32(end + len(w.header) - 8)
 	w.subChunk2Size = uint32(end)
 
 	binary.LittleEndian.PutUint32(w.header[4:8], w.chunkSize)
-	binary.LittleEndian.PutUint32(w.header[40:44], w.subChunk2Size)
+	binary.LittleEndian.PutUint16(w.header[22:24], w.numChannels)
+	binary.LittleEndian.PutUint32(w.header[24:28], w.sampleRate)
+	binary.LittleEndian.PutUint32(w.header[28:32], w.byteRate())
+	binary.LittleEndian.PutUint16(w.header[32:34], w.blockAlign())
+	binary.LittleEndian.PutUint16(w.header[34:36], uint16(w.bitsPerSample))
+	binary.LittleEndian.PutUint32(w.header[len(w.header)-4:], w.subChunk2Size)
+
+	if w.maskOffset > 0 {
+		binary.LittleEndian.PutUint16(w.header[w.maskOffset-2:w.maskOffset], uint16(w.bitsPerSample))
+		binary.LittleEndian.PutUint32(w.header[w.maskOffset:w.maskOffset+4], w.channelMask)
+	}
 
-	if !reset {
-		w.pointer = uint(start + blocksOut*int(numChannels))
+	if w.factOffset > 0 {
+		frames := uint32(w.length / int(w.numChannels))
+		binary.LittleEndian.PutUint32(w.header[w.factOffset:w.factOffset+4], frames)
 	}
 }
 
+// validateHeader checks that the fields of the header agree with each other
+// and with the sound data
+func (w *wavData) validateHeader() error {
+	var (
+		le            = binary.LittleEndian
+		chunkSize     = le.Uint32(w.header[4:8])
+		numChannels   = le.Uint16(w.header[22:24])
+		sampleRate    = le.Uint32(w.header[24:28])
+		byteRate      = le.Uint32(w.header[28:32])
+		blockAlign    = le.Uint16(w.header[32:34])
+		bitsPerSample = le.Uint16(w.header[34:36])
+		subChunk2Size = le.Uint32(w.header[len(w.header)-4:])
+		dataSize      = uint32(w.length * (w.bitsPerSample >> 3))
+	)
+
+	switch {
+	case numChannels != w.numChannels || sampleRate != w.sampleRate || int(bitsPerSample) != w.bitsPerSample:
+		return fmt.Errorf("%w: WAV header format %d channels %d Hz %d bits does not match %d channels %d Hz %d bits", ErrInvalidHeader,
+			numChannels, sampleRate, bitsPerSample, w.numChannels, w.sampleRate, w.bitsPerSample)
+	case blockAlign != numChannels*(bitsPerSample>>3):
+		return fmt.Errorf("%w: WAV header block align %d is not %d channels of %d bits", ErrInvalidHeader, blockAlign, numChannels, bitsPerSample)
+	case byteRate != sampleRate*uint32(blockAlign):
+		return fmt.Errorf("%w: WAV header byte rate %d is not %d Hz of block align %d", ErrInvalidHeader, byteRate, sampleRate, blockAlign)
+	case subChunk2Size != dataSize || subChunk2Size%uint32(blockAlign) != 0:
+		return fmt.Errorf("%w: WAV header data size %d does not match %d bytes of samples", ErrInvalidHeader, subChunk2Size, dataSize)
+	case chunkSize != uint32(len(w.header)-8)+subChunk2Size:
+		return fmt.Errorf("%w: WAV header chunk size %d does not match %d bytes of header and data size %d", ErrInvalidHeader, chunkSize, len(w.header), subChunk2Size)
+	}
+
+	return nil
+}
+
+// addChunk inserts a chunk into the header before the data chunk
+func (w *wavData) addChunk(id string, data []byte) {
+	dataHeader := append([]byte{}, w.header[len(w.header)-8:]...)
+
+	chunk := make([]byte, 8, 8+len(data)+1)
+	copy(chunk, id)
+	binary.LittleEndian.PutUint32(chunk[4:8], uint32(len(data)))
+	chunk = append(chunk, data...)
+
+	// chunks are aligned to even bytes
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0x00)
+	}
+
+	w.header = append(append(w.header[:len(w.header)-8], chunk...), dataHeader...)
+	w.updateSizes()
+}
+
 // writeProgression adds specified notes in series
 // (or asynchronously if offset property is specified in a note)
 // each playing for time * relativeDuration seconds
 // followed by a time * (1 - relativeDuration) second rest
-func (w *wavData) writeProgression(notes []*progression, amplitude float32, channels []int, blend bool, reset bool, relativeDuration int) {
+// Unrecognized notes are written as silence and returned as warnings.
+func (w *wavData) writeProgression(notes []*progression, amplitude float32, channels []int, blend bool, reset bool, relativeDuration int) []error {
 	start := w.pointer
+	warnings := make([]error, 0)
+
+	// notes before zero (e.g. pickup measures) shift the whole progression
+	origin := math.Min(progressionStart(notes), 0)
 
 	var max uint
 	for i := 0; i < len(notes); i++ {
 		var (
 			time = notes[i].time
-			off  = notes[i].offset
+			off  = notes[i].offset - origin
 		)
-		sample := int(math.Round(float64(w.sampleRate) * float64(off+time)))
+		sample := w.frame(off + time)
 		val := uint(w.numChannels) * uint(sample+1)
 
 		if max < val {
 			max = val
 		}
 	}
-	w.data = make([]float32, max)
+	w.setSamples(w.makeSamples(int(max)))
 
 	for i := 0; i < len(notes); i++ {
 		var (
-			note = notes[i].note
-			time = notes[i].time
-			amp  = notes[i].amplitude
-			off  = notes[i].offset
+			note  = notes[i].note
+			time  = notes[i].time
+			amp   = notes[i].amplitude
+			off   = notes[i].offset - origin
+			cents = notes[i].cents
+			// frames already sounded by a continued note
+			elapsed = w.frame(notes[i].elapsed)
+
+			// both ends are rounded from absolute time
+			// so that rounding errors do not accumulate over notes
+			startFrame = w.frame(off)
+			endFrame   = w.frame(off + time)
 		)
 
 		// for asynchronous progression
-		w.seek(off)
+		w.pointer = uint(w.numChannels) * uint(startFrame)
+
+		if notes[i].noise {
+			semitone, _ := semitoneFromNote(note)
+			wave := newNoiseGenerator(w.noiseColor, hitSeed(w.noiseSeed, semitone, startFrame)).percussion(w.sampleRate)
+			wave = w.withEnvelope(wave, notes[i].envelope)
+			w.writeWave(wave, endFrame-startFrame, amp*amplitude, channels, blend, false)
+			continue
+		}
 
-		w.writeNote(note, time, amp*amplitude, channels, blend, false, 1)
+		// rest for unrecognized notes
+		var frequency float32
+		if semitone, err := semitoneFromNote(note); err == nil {
+			frequency = detune(frequencyFromSemitone(semitone), cents)
+		} else {
+			warnings = append(warnings, err)
+		}
+		if w.equalLoudness {
+			amp *= loudnessGain(frequency)
+		}
+		if w.phaseSpread > 0 && w.numChannels > 1 && len(channels) == 0 {
+			// decorrelate the channels by starting each at another phase
+			semitone, _ := semitoneFromNote(note)
+			for c := 0; c < int(w.numChannels); c++ {
+				seed := hitSeed(hitSeed(w.phaseSeed, semitone, startFrame), c, 0)
+				offset := float64(seed) / (1 << 32) * w.phaseSpread
+
+				w.pointer = uint(w.numChannels) * uint(startFrame)
+				wave := w.withEnvelope(w.noteWave(frequency, elapsed, offset, notes[i].bend), notes[i].envelope)
+				w.writeWave(wave, endFrame-startFrame, amp*amplitude, []int{c}, blend, false)
+			}
+			continue
+		}
+
+		wave := w.withEnvelope(w.noteWave(frequency, elapsed, 0, notes[i].bend), notes[i].envelope)
+		w.writeWave(wave, endFrame-startFrame, amp*amplitude, channels, blend, false)
 	}
 
 	if reset {
 		w.pointer = start
 	}
+
+	return warnings
+}
+
+// peaks returns the peak absolute amplitude of each channel
+func (w *wavData) peaks() []float32 {
+	numChannels := int(w.numChannels)
+	peaks := make([]float32, numChannels)
+
+	for i := 0; i < w.length; i++ {
+		d := w.data[i]
+		if d < 0 {
+			d = -d
+		}
+		if d > peaks[i%numChannels] {
+			peaks[i%numChannels] = d
+		}
+	}
+
+	return peaks
+}
+
+// envelope returns the RMS level of all channels for every interval in seconds
+func (w *wavData) envelope(interval float32) []float32 {
+	numChannels := int(w.numChannels)
+	window := maxInt(int(math.Round(float64(w.sampleRate)*float64(interval))), 1) * numChannels
+	levels := make([]float32, 0, w.length/window+1)
+
+	for start := 0; start < w.length; start += window {
+		end := minInt(start+window, w.length)
+
+		var sum float64
+		for _, d := range w.data[start:end] {
+			sum += float64(d) * float64(d)
+		}
+		levels = append(levels, float32(math.Sqrt(sum/float64(end-start))))
+	}
+
+	return levels
+}
+
+// planar returns the sound data of each channel after another
+func (w *wavData) planar() []float32 {
+	var (
+		numChannels = int(w.numChannels)
+		frames      = w.length / numChannels
+		data        = make([]float32, frames*numChannels)
+	)
+
+	for i := 0; i < frames; i++ {
+		for c := 0; c < numChannels; c++ {
+			data[c*frames+i] = w.data[i*numChannels+c]
+		}
+	}
+
+	return data
+}
+
+// channelGains returns the factor of each channel
+// which makes its peak reach the normalized amplitude
+func (w *wavData) channelGains(amplitude float32) []float32 {
+	gains := w.peaks()
+
+	for i, peak := range gains {
+		if peak > 0 {
+			gains[i] = amplitude / peak
+		}
+	}
+
+	return gains
+}
+
+// scaleChannels multiplies each channel by its gain
+func (w *wavData) scaleChannels(gains []float32) {
+	numChannels := int(w.numChannels)
+
+	for i := 0; i < w.length; i++ {
+		w.data[i] *= gains[i%numChannels]
+	}
 }
 
 func (w *wavData) typeData() *bytes.Buffer {
+	buf := make([]byte, w.subChunk2Size)
+	w.putSamples(buf, 0)
+
+	return bytes.NewBuffer(buf)
+}
+
+// putSamples converts the sound data from sample start into typed data
+// filling buf (whose length is a multiple of the size of a sample)
+func (w *wavData) putSamples(buf []byte, start int) {
 	bytesPerSample := w.bitsPerSample >> 3
-	size := w.subChunk2Size
-	samples := int(size) / bytesPerSample
-	buf := make([]byte, size)
+	samples := len(buf) / bytesPerSample
 
 	// convert signed normalized sound data to typed integer data
 	// i.e. [-1, 1] -> [INT_MIN, INT_MAX]
-	amplitude := float32(math.Pow(2, float64(w.bitsPerSample-1)) - 1)
+	// clipping samples out of range
+	// (in float64 as float32 cannot hold 24-bit and 32-bit integers exactly)
+	amplitude := math.Pow(2, float64(w.bitsPerSample-1)) - 1
+
+	// sample converts to the signed integer
+	// reaching INT_MIN at -1 as negative range is one larger
+	sample := func(i int) int64 {
+		d := float64(clampSample(w.data[start+i]))
+		if d < 0 {
+			return int64(math.Round(d * (amplitude + 1)))
+		}
+		return int64(math.Round(d * amplitude))
+	}
+
+	if w.audioFormat == wavFormatFloat {
+		for i := 0; i < samples; i++ {
+			binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(w.data[start+i]))
+		}
+		return
+	}
 
 	switch bytesPerSample {
 	case 1:
 		for i := 0; i < samples; i++ {
-			buf[i*2] = uint8(w.data[i]*amplitude+0x80) & 0xff
+			// 8-bit samples are unsigned
+			buf[i] = uint8(sample(i) + 0x80)
 		}
 	case 2:
 		for i := 0; i < samples; i++ {
-			// [INT16_MIN, INT16_MAX] -> [0, UINT16_MAX]
-			d := uint16(w.data[i]*amplitude+0x10000) & 0xffff
+			// two's complement in little endian
+			d := uint16(sample(i))
 
 			// unwrap inner loop
 			buf[i*2] = uint8(d & 0xff)
@@ -302,28 +751,148 @@ func (w *wavData) typeData() *bytes.Buffer {
 		}
 	case 3:
 		for i := 0; i < samples; i++ {
-			d := uint32(w.data[i]*amplitude+0x1000000) & 0xFFFFFF
+			d := uint32(sample(i)) & 0xFFFFFF
 			buf[i*3] = uint8(d & 0xff)
 			buf[i*3+1] = uint8((d >> 8) & 0xff)
 			buf[i*3+2] = uint8(d >> 16)
 		}
 	case 4:
 		for i := 0; i < samples; i++ {
-			d := uint32(w.data[i]*amplitude+0x100000000) & 0xFFFFFFFF
+			d := uint32(sample(i))
 			buf[i*4] = uint8(d & 0xff)
 			buf[i*4+1] = uint8((d >> 8) & 0xff)
 			buf[i*4+2] = uint8((d >> 16) & 0xff)
 			buf[i*4+3] = uint8(d >> 24)
 		}
 	}
-
-	return bytes.NewBuffer(buf)
 }
 
+// toBuffer returns the WAV converting the sound data
+// directly after the header
 func (w *wavData) toBuffer() *bytes.Buffer {
-	data := w.typeData().Bytes()
-	buf := make([]byte, 0, len(w.header)+len(data))
-	buf = append(buf, w.header...)
-	buf = append(buf, data...)
+	buf := make([]byte, len(w.header)+int(w.subChunk2Size))
+	copy(buf, w.header)
+	w.putSamples(buf[len(w.header):], 0)
 	return bytes.NewBuffer(buf)
 }
+
+// writeChunkSamples is the number of samples converted at once by WriteTo
+const writeChunkSamples = 16384
+
+// WriteTo writes the WAV to writer converting the sound data in chunks
+// instead of holding the whole typed data
+func (w *wavData) WriteTo(writer io.Writer) (int64, error) {
+	n, err := writer.Write(w.header)
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	bytesPerSample := w.bitsPerSample >> 3
+	samples := int(w.subChunk2Size) / bytesPerSample
+	buf := make([]byte, minInt(samples, writeChunkSamples)*bytesPerSample)
+	for start := 0; start < samples; start += writeChunkSamples {
+		chunk := buf[:minInt(samples-start, writeChunkSamples)*bytesPerSample]
+		w.putSamples(chunk, start)
+
+		n, err := writer.Write(chunk)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// decodeWAV reads the sound data of a PCM or floating point WAV
+// into normalized samples
+func decodeWAV(data []byte) (*wavData, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("%w: not a WAV", ErrUnsupportedFormat)
+	}
+
+	var (
+		audioFormat   uint16
+		numChannels   uint16
+		sampleRate    uint32
+		bitsPerSample int
+		samples       []byte
+	)
+
+	// chunks are aligned to even bytes
+	for offset := 12; offset+8 <= len(data); {
+		id := string(data[offset : offset+4])
+		length := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		offset += 8
+
+		if length < 0 || length > len(data)-offset {
+			return nil, fmt.Errorf("%w: WAV chunk %q of length %d", ErrTruncated, id, length)
+		}
+		chunk := data[offset : offset+length]
+
+		switch id {
+		case "fmt ":
+			if length < 16 {
+				return nil, fmt.Errorf("%w: fmt chunk of length %d", ErrTruncated, length)
+			}
+			audioFormat = binary.LittleEndian.Uint16(chunk[0:2])
+			numChannels = binary.LittleEndian.Uint16(chunk[2:4])
+			sampleRate = binary.LittleEndian.Uint32(chunk[4:8])
+			bitsPerSample = int(binary.LittleEndian.Uint16(chunk[14:16]))
+
+			// sub format GUID starts with the audio format
+			if audioFormat == wavFormatExtensible && length >= 26 {
+				audioFormat = binary.LittleEndian.Uint16(chunk[24:26])
+			}
+		case "data":
+			samples = chunk
+		}
+
+		offset += length + length%2
+	}
+
+	if numChannels == 0 || sampleRate == 0 || samples == nil {
+		return nil, fmt.Errorf("%w: WAV without fmt or data chunk", ErrInvalidHeader)
+	}
+	if audioFormat != wavFormatPCM && !(audioFormat == wavFormatFloat && bitsPerSample == 32) {
+		return nil, fmt.Errorf("%w: WAV audio format %d with %d bits per sample", ErrUnsupportedFormat, audioFormat, bitsPerSample)
+	}
+
+	w, err := newWAV(wavFormatPCM, numChannels, sampleRate, bitsPerSample, true, make([]byte, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	bytesPerSample := bitsPerSample >> 3
+	n := len(samples) / bytesPerSample / int(numChannels) * int(numChannels)
+	amplitude := math.Pow(2, float64(bitsPerSample-1))
+
+	w.data = make([]float32, n)
+	for i := 0; i < n; i++ {
+		b := samples[i*bytesPerSample : (i+1)*bytesPerSample]
+
+		var d int32
+		switch bytesPerSample {
+		case 1:
+			// 8-bit samples are unsigned
+			d = int32(b[0]) - 0x80
+		case 2:
+			d = int32(int16(binary.LittleEndian.Uint16(b)))
+		case 3:
+			// sign extend from 24 bits
+			d = int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		case 4:
+			if audioFormat == wavFormatFloat {
+				w.data[i] = math.Float32frombits(binary.LittleEndian.Uint32(b))
+				continue
+			}
+			d = int32(binary.LittleEndian.Uint32(b))
+		}
+		w.data[i] = float32(float64(d) / amplitude)
+	}
+	w.length = n
+	w.updateSizes()
+
+	return w, nil
+}
@@ -0,0 +1,514 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// riffChunks returns the chunks of a WAV by id
+func riffChunks(t *testing.T, wav []byte) map[string][]byte {
+	t.Helper()
+
+	if len(wav) < 12 || string(wav[0:4]) != "RIFF" || string(wav[8:12]) != "WAVE" {
+		t.Fatalf("not a WAV")
+	}
+	chunks := make(map[string][]byte)
+	for offset := 12; offset+8 <= len(wav); {
+		id := string(wav[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(wav[offset+4 : offset+8]))
+		if offset+8+size > len(wav) {
+			t.Fatalf("chunk %q of %d bytes exceeds the WAV", id, size)
+		}
+		chunks[id] = wav[offset+8 : offset+8+size]
+		offset += 8 + size + size%2
+	}
+	return chunks
+}
+
+func TestHeaderSizesFollowWrittenSamples(t *testing.T) {
+	tests := []struct {
+		name      string
+		allocated int
+		seek      float32
+		time      float32
+		dataSize  uint32
+	}{
+		{"empty buffer", 0, 0, 0.1, 4410 * 2},
+		{"short note into a larger buffer", 44100, 0, 0.1, 4410 * 2},
+		{"note after the write position", 44100, 0.5, 0.1, 26460 * 2},
+		{"note beyond the buffer", 1000, 0, 0.1, 4410 * 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := newWAV(wavFormatPCM, 1, 44100, 16, true, nil)
+			if err != nil {
+				t.Fatalf("newWAV() error = %v", err)
+			}
+			w.grow(tt.allocated)
+
+			w.seek(tt.seek)
+			if err := w.writeNote("A4", tt.time, 0.5, nil, true, false, 1); err != nil {
+				t.Fatalf("writeNote() error = %v", err)
+			}
+
+			header := w.toBuffer().Bytes()[:44]
+			if got := binary.LittleEndian.Uint32(header[40:44]); got != tt.dataSize {
+				t.Errorf("data size = %d, want %d", got, tt.dataSize)
+			}
+			if got := binary.LittleEndian.Uint32(header[4:8]); got != tt.dataSize+36 {
+				t.Errorf("chunk size = %d, want %d", got, tt.dataSize+36)
+			}
+			if err := w.validateHeader(); err != nil {
+				t.Errorf("validateHeader() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestFloatSamples(t *testing.T) {
+	data := smf(0, 480, track(noteOn(0, 69, 100), noteOff(480, 69)))
+
+	tests := []struct {
+		channels    int
+		audioFormat uint16
+	}{
+		{1, wavFormatFloat},
+		{2, wavFormatFloat},
+		{4, wavFormatExtensible},
+	}
+
+	for _, tt := range tests {
+		opts := Options{Channels: tt.channels, FloatSamples: true}
+		buf, err := MIDIToWAVWithOptions(bytes.NewReader(data), opts)
+		if err != nil {
+			t.Fatalf("MIDIToWAVWithOptions() error = %v", err)
+		}
+		samples, _, err := MIDIToFloat32(bytes.NewReader(data), opts)
+		if err != nil {
+			t.Fatalf("MIDIToFloat32() error = %v", err)
+		}
+
+		chunks := riffChunks(t, buf.Bytes())
+		fmtChunk, fact, pcm := chunks["fmt "], chunks["fact"], chunks["data"]
+		if got := binary.LittleEndian.Uint16(fmtChunk[0:2]); got != tt.audioFormat {
+			t.Errorf("%d channels: audio format = %#x, want %#x", tt.channels, got, tt.audioFormat)
+		}
+		if tt.audioFormat == wavFormatExtensible {
+			if got := binary.LittleEndian.Uint16(fmtChunk[24:26]); got != wavFormatFloat {
+				t.Errorf("%d channels: sub format = %#x, want %#x", tt.channels, got, wavFormatFloat)
+			}
+		}
+		if got := binary.LittleEndian.Uint16(fmtChunk[14:16]); got != 32 {
+			t.Errorf("%d channels: bits per sample = %d, want 32", tt.channels, got)
+		}
+
+		frames := len(samples) / tt.channels
+		if len(fact) != 4 || binary.LittleEndian.Uint32(fact) != uint32(frames) {
+			t.Errorf("%d channels: fact chunk = %v, want %d sample frames", tt.channels, fact, frames)
+		}
+		if len(pcm) != len(samples)*4 {
+			t.Fatalf("%d channels: %d bytes of data, want %d", tt.channels, len(pcm), len(samples)*4)
+		}
+		for i, want := range samples {
+			if got := math.Float32frombits(binary.LittleEndian.Uint32(pcm[i*4:])); got != want {
+				t.Fatalf("%d channels: sample %d = %g, want %g", tt.channels, i, got, want)
+			}
+		}
+	}
+}
+
+func TestHeaderFormat(t *testing.T) {
+	data := smf(0, 480, track(noteOn(0, 69, 100), noteOff(480, 69)))
+
+	tests := []struct {
+		name          string
+		opts          Options
+		channels      uint16
+		sampleRate    uint32
+		byteRate      uint32
+		blockAlign    uint16
+		bitsPerSample uint16
+	}{
+		{
+			name:     "default",
+			opts:     Options{},
+			channels: 1, sampleRate: 44100, byteRate: 88200, blockAlign: 2, bitsPerSample: 16,
+		},
+		{
+			name:     "stereo 24-bit 48000 Hz",
+			opts:     Options{Channels: 2, BitsPerSample: 24, SampleRate: 48000},
+			channels: 2, sampleRate: 48000, byteRate: 288000, blockAlign: 6, bitsPerSample: 24,
+		},
+		{
+			name:     "mono 8-bit 22050 Hz",
+			opts:     Options{BitsPerSample: 8, SampleRate: 22050},
+			channels: 1, sampleRate: 22050, byteRate: 22050, blockAlign: 1, bitsPerSample: 8,
+		},
+		{
+			name:     "quad 32-bit 96000 Hz",
+			opts:     Options{Channels: 4, BitsPerSample: 32, SampleRate: 96000},
+			channels: 4, sampleRate: 96000, byteRate: 1536000, blockAlign: 16, bitsPerSample: 32,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := MIDIToWAVWithOptions(bytes.NewReader(data), tt.opts)
+			if err != nil {
+				t.Fatalf("MIDIToWAVWithOptions() error = %v", err)
+			}
+			chunks := riffChunks(t, buf.Bytes())
+			format := chunks["fmt "]
+
+			le := binary.LittleEndian
+			if got := le.Uint16(format[2:4]); got != tt.channels {
+				t.Errorf("channels = %d, want %d", got, tt.channels)
+			}
+			if got := le.Uint32(format[4:8]); got != tt.sampleRate {
+				t.Errorf("sample rate = %d, want %d", got, tt.sampleRate)
+			}
+			if got := le.Uint32(format[8:12]); got != tt.byteRate {
+				t.Errorf("byte rate = %d, want %d", got, tt.byteRate)
+			}
+			if got := le.Uint16(format[12:14]); got != tt.blockAlign {
+				t.Errorf("block align = %d, want %d", got, tt.blockAlign)
+			}
+			if got := le.Uint16(format[14:16]); got != tt.bitsPerSample {
+				t.Errorf("bits per sample = %d, want %d", got, tt.bitsPerSample)
+			}
+			if n := len(chunks["data"]); n == 0 || n%int(tt.blockAlign) != 0 {
+				t.Errorf("data of %d bytes is not a whole number of blocks of %d bytes", n, tt.blockAlign)
+			}
+		})
+	}
+}
+
+func TestSampleConversion(t *testing.T) {
+	// full scale, silence, half scale and clipped samples
+	input := []float32{1, -1, 0, 0.5, -0.5, 1.5, -1.5}
+
+	tests := []struct {
+		bitsPerSample int
+		want          []int64
+	}{
+		// 8-bit samples are unsigned with silence at 0x80
+		{bitsPerSample: 8, want: []int64{0xff, 0x00, 0x80, 0xc0, 0x40, 0xff, 0x00}},
+		{bitsPerSample: 16, want: []int64{0x7fff, -0x8000, 0, 0x4000, -0x4000, 0x7fff, -0x8000}},
+		{bitsPerSample: 24, want: []int64{0x7fffff, -0x800000, 0, 0x400000, -0x400000, 0x7fffff, -0x800000}},
+		{bitsPerSample: 32, want: []int64{0x7fffffff, -0x80000000, 0, 0x40000000, -0x40000000, 0x7fffffff, -0x80000000}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d bits", tt.bitsPerSample), func(t *testing.T) {
+			w, err := newWAV(wavFormatPCM, 1, 44100, tt.bitsPerSample, true, make([]byte, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.data = append([]float32(nil), input...)
+			w.length = len(input)
+
+			bytesPerSample := tt.bitsPerSample / 8
+			buf := make([]byte, len(input)*bytesPerSample)
+			w.putSamples(buf, 0)
+
+			for i, want := range tt.want {
+				b := buf[i*bytesPerSample : (i+1)*bytesPerSample]
+				var got int64
+				switch bytesPerSample {
+				case 1:
+					got = int64(b[0])
+				case 2:
+					got = int64(int16(binary.LittleEndian.Uint16(b)))
+				case 3:
+					// sign extend the 24-bit two's complement
+					got = int64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8)
+				case 4:
+					got = int64(int32(binary.LittleEndian.Uint32(b)))
+				}
+				if got != want {
+					t.Errorf("sample %g = %#x, want %#x", input[i], got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNegativeOffsets(t *testing.T) {
+	type span struct {
+		start, end float64
+		sound      bool
+	}
+	tests := []struct {
+		name    string
+		offsets []float64
+		length  float64
+		spans   []span
+	}{
+		{
+			name:    "pickup note",
+			offsets: []float64{-0.5, 0.5},
+			length:  1.25,
+			spans:   []span{{0, 0.25, true}, {0.3, 0.95, false}, {1, 1.25, true}},
+		},
+		{
+			name:    "all notes before zero",
+			offsets: []float64{-2, -1.5},
+			length:  0.75,
+			spans:   []span{{0, 0.25, true}, {0.3, 0.45, false}, {0.5, 0.75, true}},
+		},
+		{
+			name:    "no negative offsets",
+			offsets: []float64{0.25, 0.75},
+			length:  1,
+			spans:   []span{{0, 0.2, false}, {0.25, 0.5, true}, {0.55, 0.7, false}, {0.75, 1, true}},
+		},
+	}
+
+	for _, tt := range tests {
+		w, err := newOutput(Options{Channels: 1}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var notes []*progression
+		for _, off := range tt.offsets {
+			notes = append(notes, &progression{note: "A4", time: 0.25, offset: off, amplitude: 1})
+		}
+		w.seek(-1)
+		if w.pointer != 0 {
+			t.Errorf("%s: seek to negative time set pointer %d, want 0", tt.name, w.pointer)
+		}
+		w.writeProgression(notes, 1, nil, false, true, 0)
+
+		if got, want := len(w.data), w.frame(tt.length)+1; got != want {
+			t.Errorf("%s: got %d samples, want %d", tt.name, got, want)
+		}
+		for _, s := range tt.spans {
+			var peak float32
+			for _, v := range w.data[w.frame(s.start):w.frame(s.end)] {
+				if v < 0 {
+					v = -v
+				}
+				if v > peak {
+					peak = v
+				}
+			}
+			if sound := peak > 0.5; sound != s.sound {
+				t.Errorf("%s: peak %v in [%v, %v), want sound %v", tt.name, peak, s.start, s.end, s.sound)
+			}
+		}
+		w.release()
+	}
+}
+
+func TestExtensibleHeader(t *testing.T) {
+	data := smf(0, 480, track(noteOn(0, 69, 100), noteOff(480, 69)))
+	guid := []byte{0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+
+	tests := []struct {
+		name       string
+		opts       Options
+		extensible bool
+		mask       uint32
+		subFormat  uint16
+		validBits  uint16
+		fact       bool
+	}{
+		{
+			name: "stereo",
+			opts: Options{Channels: 2},
+		},
+		{
+			name:       "quad",
+			opts:       Options{Channels: 4},
+			extensible: true, mask: 0x33, subFormat: wavFormatPCM, validBits: 16,
+		},
+		{
+			name:       "stereo with channel mask",
+			opts:       Options{Channels: 2, ChannelMask: 0x3},
+			extensible: true, mask: 0x3, subFormat: wavFormatPCM, validBits: 16,
+		},
+		{
+			name:       "5.1 float",
+			opts:       Options{Channels: 6, ChannelMask: 0x3F, FloatSamples: true},
+			extensible: true, mask: 0x3F, subFormat: wavFormatFloat, validBits: 32, fact: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := MIDIToWAVWithOptions(bytes.NewReader(data), tt.opts)
+			if err != nil {
+				t.Fatalf("MIDIToWAVWithOptions() error = %v", err)
+			}
+			chunks := riffChunks(t, buf.Bytes())
+			format := chunks["fmt "]
+			le := binary.LittleEndian
+
+			if !tt.extensible {
+				if len(format) != 16 || le.Uint16(format[0:2]) != wavFormatPCM {
+					t.Errorf("fmt chunk = % x, want 16 bytes of PCM", format)
+				}
+				return
+			}
+			if len(format) != 40 {
+				t.Fatalf("fmt chunk size = %d, want 40", len(format))
+			}
+			if got := le.Uint16(format[0:2]); got != wavFormatExtensible {
+				t.Errorf("format tag = %#x, want %#x", got, wavFormatExtensible)
+			}
+			if got := le.Uint16(format[16:18]); got != 22 {
+				t.Errorf("extension size = %d, want 22", got)
+			}
+			if got := le.Uint16(format[18:20]); got != tt.validBits {
+				t.Errorf("valid bits = %d, want %d", got, tt.validBits)
+			}
+			if got := le.Uint32(format[20:24]); got != tt.mask {
+				t.Errorf("channel mask = %#x, want %#x", got, tt.mask)
+			}
+			if got := le.Uint16(format[24:26]); got != tt.subFormat {
+				t.Errorf("sub format = %d, want %d", got, tt.subFormat)
+			}
+			if !bytes.Equal(format[28:40], guid) {
+				t.Errorf("sub format GUID = % x, want % x", format[28:40], guid)
+			}
+			if _, ok := chunks["fact"]; ok != tt.fact {
+				t.Errorf("fact chunk present = %v, want %v", ok, tt.fact)
+			}
+		})
+	}
+}
+
+func TestPitchShift(t *testing.T) {
+	// A4 on channel 0 for a second
+	data := smf(0, 480, track(noteOn(0, 69, 100), noteOff(960, 69)))
+
+	// frequency measures the rising zero crossings between 0.1 and 0.9 seconds
+	frequency := func(samples []float32, rate uint32) float64 {
+		var first, last float64
+		crossings := 0
+		for i := int(0.1 * float64(rate)); i < int(0.9*float64(rate)); i++ {
+			a, b := samples[i-1], samples[i]
+			if a < 0 && b >= 0 {
+				x := float64(i-1) + float64(-a/(b-a))
+				if crossings == 0 {
+					first = x
+				}
+				last = x
+				crossings++
+			}
+		}
+		return float64(crossings-1) / (last - first) * float64(rate)
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want float64
+	}{
+		{"none", Options{}, 440},
+		{"a semitone up", Options{PitchShiftCents: 100}, 466.1638},
+		{"30 cents flat", Options{PitchShiftCents: -30}, 440 * math.Pow(2, -30.0/1200)},
+		{"an octave down", Options{PitchShiftCents: -1200}, 220},
+		{"with Detune", Options{PitchShiftCents: 50, Detune: map[int]float32{0: 50}}, 466.1638},
+		{"Detune of another channel", Options{PitchShiftCents: 50, Detune: map[int]float32{1: 50}}, 440 * math.Pow(2, 50.0/1200)},
+	}
+
+	for _, tt := range tests {
+		samples, rate, err := MIDIToFloat32(bytes.NewReader(data), tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := frequency(samples, rate); math.Abs(got-tt.want) > 0.05 {
+			t.Errorf("%s: frequency = %.3f Hz, want %.3f Hz", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPhaseSpread(t *testing.T) {
+	data := smf(0, 480, track(
+		noteOn(0, 57, 100), noteOn(0, 64, 100), noteOff(960, 57), noteOff(0, 64),
+	))
+
+	// channels returns the planar samples of the channels and their RMS levels
+	channels := func(opts Options) ([][]float32, []float64) {
+		opts.Channels = 2
+		opts.Layout = LayoutPlanar
+		samples, _, err := MIDIToFloat32(bytes.NewReader(data), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := len(samples) / 2
+		split := [][]float32{samples[:n], samples[n:]}
+		var rms []float64
+		for _, c := range split {
+			var sum float64
+			for _, s := range c {
+				sum += float64(s) * float64(s)
+			}
+			rms = append(rms, math.Sqrt(sum/float64(len(c))))
+		}
+		return split, rms
+	}
+	equal := func(a, b []float32) bool {
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return len(a) == len(b)
+	}
+
+	_, reference := channels(Options{})
+
+	tests := []struct {
+		name   string
+		opts   Options
+		differ bool
+	}{
+		{"off", Options{}, false},
+		{"quarter cycle", Options{PhaseSpread: 0.25}, true},
+		{"full cycle", Options{PhaseSpread: 1}, true},
+		{"seeded", Options{PhaseSpread: 1, PhaseSeed: 7}, true},
+	}
+
+	outputs := make([][][]float32, len(tests))
+	for i, tt := range tests {
+		split, rms := channels(tt.opts)
+		if differ := !equal(split[0], split[1]); differ != tt.differ {
+			t.Errorf("%s: channels differ %v, want %v", tt.name, differ, tt.differ)
+		}
+		for c := range rms {
+			if math.Abs(rms[c]-reference[c])/reference[c] > 0.02 {
+				t.Errorf("%s: channel %d has RMS %v, want %v", tt.name, c, rms[c], reference[c])
+			}
+		}
+
+		again, _ := channels(tt.opts)
+		if !equal(split[0], again[0]) || !equal(split[1], again[1]) {
+			t.Errorf("%s: two renders differ", tt.name)
+		}
+		outputs[i] = split
+	}
+
+	if equal(outputs[2][1], outputs[3][1]) {
+		t.Errorf("PhaseSeed 7 renders the same phases as the default seed")
+	}
+}
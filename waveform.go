@@ -0,0 +1,72 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import "math"
+
+// Waveform is the shape of the oscillator rendering the notes
+type Waveform int
+
+const (
+	// WaveformSine renders pure tones
+	WaveformSine Waveform = iota
+	// WaveformSquare alternates between full positive and negative amplitude
+	WaveformSquare
+	// WaveformSawtooth rises linearly and drops at the end of each cycle
+	WaveformSawtooth
+	// WaveformTriangle rises and falls linearly
+	WaveformTriangle
+)
+
+// defaultSquareDuty is the duty cycle of square waves if not configured
+const defaultSquareDuty = 0.5
+
+// sample returns the normalized value at phase (in cycles)
+// where square waves are high for the fraction duty of each cycle
+func (f Waveform) sample(phase, duty float64) float32 {
+	// position within the cycle (0 to 1)
+	_, x := math.Modf(phase)
+
+	switch f {
+	case WaveformSquare:
+		// zero at the edges as the sign of the sine
+		if x == 0 || x == duty {
+			return 0
+		}
+		if x < duty {
+			return 1
+		}
+		return -1
+	case WaveformSawtooth:
+		return float32(2*x - 1)
+	case WaveformTriangle:
+		return float32(1 - 4*math.Abs(x-0.5))
+	default:
+		return float32(math.Sin(2 * math.Pi * phase))
+	}
+}
+
+// startPhase returns the phase (in cycles) where the waveform crosses zero
+// so that notes do not start with a jump
+func (f Waveform) startPhase() float64 {
+	switch f {
+	case WaveformSawtooth:
+		return 0.5
+	case WaveformTriangle:
+		return 0.25
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 entooone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestWaveformStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		waveform Waveform
+		duty     float64
+	}{
+		{name: "sine", waveform: WaveformSine},
+		{name: "square", waveform: WaveformSquare, duty: 0.5},
+		{name: "narrow square", waveform: WaveformSquare, duty: 0.125},
+		{name: "sawtooth", waveform: WaveformSawtooth},
+		{name: "triangle", waveform: WaveformTriangle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := newWAV(wavFormatPCM, 1, 44100, 16, true, make([]byte, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.waveform = tt.waveform
+			w.squareDuty = tt.duty
+
+			// the oscillator starts at a zero crossing
+			if got := w.toneWave(440, 0, 0)(0); got != 0 {
+				t.Errorf("oscillator starts at %g, want 0", got)
+			}
+
+			// and the note rises from silence without a jump
+			w.writeTone(440, 0, 4410, 1, []int{}, true, false)
+			if w.data[0] != 0 {
+				t.Errorf("first sample = %g, want 0", w.data[0])
+			}
+			for i := 1; i < 4; i++ {
+				if d := math.Abs(float64(w.data[i] - w.data[i-1])); d > 0.05 {
+					t.Errorf("sample %d jumps by %g", i, d)
+				}
+			}
+		})
+	}
+}
+
+func TestSquareDuty(t *testing.T) {
+	tests := []struct {
+		name       string
+		squareDuty float32
+		high       float64
+	}{
+		{name: "default", squareDuty: 0, high: 0.5},
+		{name: "12.5%", squareDuty: 0.125, high: 0.125},
+		{name: "25%", squareDuty: 0.25, high: 0.25},
+		{name: "50%", squareDuty: 0.5, high: 0.5},
+		{name: "75%", squareDuty: 0.75, high: 0.75},
+		{name: "out of range", squareDuty: 1.5, high: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// two seconds of A4 at 440 Hz
+			samples, _, err := MIDIToFloat32(bytes.NewReader(smf(0, 480, track(noteOn(0, 69, 100), noteOff(1920, 69)))), Options{
+				Waveform:   WaveformSquare,
+				SquareDuty: tt.squareDuty,
+			})
+			if err != nil {
+				t.Fatalf("MIDIToFloat32() error = %v", err)
+			}
+
+			// count the samples of 440 cycles past the fade-in
+			var high, low int
+			for _, s := range samples[1000:45100] {
+				switch {
+				case s > 0:
+					high++
+				case s < 0:
+					low++
+				}
+			}
+			if ratio := float64(high) / float64(high+low); math.Abs(ratio-tt.high) > 0.01 {
+				t.Errorf("high for %g of the samples, want %g", ratio, tt.high)
+			}
+		})
+	}
+}